@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+var client *github.Client
+
+// GitHub personal access token, from https://github.com/settings/applications.
+var authToken string
+
+// authSource describes where authToken was found, for diagnostics.
+var authSource string
+
+// A tokenProvider looks up a GitHub token for a host. Providers return an
+// empty token and a nil error when they simply have nothing for the host.
+type tokenProvider struct {
+	name   string
+	lookup func(host string) (string, error)
+}
+
+// tokenProviders are consulted in order by loadAuth; the first one to return
+// a token wins.
+var tokenProviders = []tokenProvider{
+	{"environment", envToken},
+	{"gh config", ghConfigToken},
+	{"git credential", gitCredentialToken},
+	{"keyring", keyringToken},
+	{"token file", fileToken},
+}
+
+func loadAuth() {
+	var providers []tokenProvider
+	if *tokenFile != "" {
+		// An explicit token file overrides the rest of the chain.
+		providers = []tokenProvider{{"token file", fileToken}}
+	} else {
+		providers = tokenProviders
+	}
+	for _, p := range providers {
+		tok, err := p.lookup(projectHost)
+		if err != nil {
+			log.Fatalf("reading token from %s: %v", p.name, err)
+		}
+		if tok != "" {
+			authToken = tok
+			authSource = p.name
+			break
+		}
+	}
+	if authToken == "" {
+		log.Fatal("no GitHub token found for ", projectHost, "\n\n"+
+			"re looks for a token in the GH_TOKEN or GITHUB_TOKEN environment variables\n"+
+			"(GH_ENTERPRISE_TOKEN or GITHUB_ENTERPRISE_TOKEN for GitHub Enterprise hosts),\n"+
+			"the gh CLI's hosts.yml, `git credential fill`, and finally ", shortTokenFilename(projectHost), ".\n\n"+
+			"Please create a personal access token at https://", projectHost, "/settings/tokens/new\n"+
+			"and make it available in one of those places to use this program.\n"+
+			"The token only needs the repo scope, or private_repo if you want to\n"+
+			"view or edit issues for private repositories.\n"+
+			"The benefit of using a personal access token over using your GitHub\n"+
+			"password directly is that you can limit its use and revoke it at any time.\n\n")
+	}
+	t := &oauth2.Transport{
+		Source: &tokenSource{AccessToken: authToken},
+	}
+	client = newClient(&http.Client{Transport: t})
+}
+
+// newClient returns a GitHub client for projectHost, which talks to the
+// Enterprise API endpoints when the host isn't github.com.
+func newClient(hc *http.Client) *github.Client {
+	if projectHost == defaultHost {
+		return github.NewClient(hc)
+	}
+	c, err := github.NewEnterpriseClient(
+		"https://"+projectHost+"/api/v3/", "https://"+projectHost+"/api/uploads/", hc)
+	if err != nil {
+		log.Fatal(fmt.Errorf("creating client for %s: %v", projectHost, err))
+	}
+	return c
+}
+
+type tokenSource oauth2.Token
+
+func (t *tokenSource) Token() (*oauth2.Token, error) {
+	return (*oauth2.Token)(t), nil
+}
+
+// envToken follows the gh CLI's conventions for token environment variables.
+func envToken(host string) (string, error) {
+	vars := []string{"GH_TOKEN", "GITHUB_TOKEN"}
+	if host != defaultHost {
+		vars = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	for _, v := range vars {
+		if tok := strings.TrimSpace(os.Getenv(v)); tok != "" {
+			return tok, nil
+		}
+	}
+	return "", nil
+}
+
+func ghConfigDir() string {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config", "gh")
+}
+
+// ghConfigToken reads the oauth_token for host out of the gh CLI's
+// hosts.yml. The file is simple enough that a line-oriented scan suffices:
+// hosts are top-level keys, and the token we want is the least-indented
+// oauth_token beneath the host.
+func ghConfigToken(host string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(ghConfigDir(), "hosts.yml"))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	inHost := false
+	tok := ""
+	tokIndent := -1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		if indent == 0 {
+			inHost = unquote(strings.TrimSuffix(trimmed, ":")) == host
+			continue
+		}
+		if !inHost || !strings.HasPrefix(trimmed, "oauth_token:") {
+			continue
+		}
+		if tokIndent == -1 || indent < tokIndent {
+			tok = unquote(strings.TrimSpace(strings.TrimPrefix(trimmed, "oauth_token:")))
+			tokIndent = indent
+		}
+	}
+	return tok, scanner.Err()
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// gitCredentialToken asks git's configured credential helpers for a password
+// for host. Prompting is disabled, so a missing credential is not an error.
+func gitCredentialToken(host string) (string, error) {
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader("protocol=https\nhost=" + host + "\n\n")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	out, err := cmd.Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return "", nil
+		}
+		if execErr, ok := err.(*exec.Error); ok && execErr.Err == exec.ErrNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "password=") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "password=")), nil
+		}
+	}
+	return "", nil
+}
+
+const tokenFileBase = ".github-issue-token"
+
+// tokenFilename returns the token file for host. github.com uses the
+// historical ~/.github-issue-token; other hosts get their own file with the
+// host name appended, so that GitHub Enterprise tokens can live alongside it.
+func tokenFilename(host string) string {
+	if *tokenFile != "" {
+		return *tokenFile
+	}
+	return filepath.Join(os.Getenv("HOME"), tokenBasename(host))
+}
+
+func shortTokenFilename(host string) string {
+	if *tokenFile != "" {
+		return *tokenFile
+	}
+	return filepath.Clean("$HOME/" + tokenBasename(host))
+}
+
+func tokenBasename(host string) string {
+	if host == defaultHost {
+		return tokenFileBase
+	}
+	return tokenFileBase + "-" + host
+}
+
+func fileToken(host string) (string, error) {
+	filename := tokenFilename(host)
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) && *tokenFile == "" {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode()&0077 != 0 {
+		return "", fmt.Errorf("%s mode is %#o, want %#o",
+			shortTokenFilename(host), fi.Mode()&0777, fi.Mode()&0700)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
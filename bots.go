@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-github/github"
+)
+
+// Comments from bots are shown according to the bot mode, from -bots or git
+// config re.bots.mode: botsShow shows them like any other, botsCollapse shows
+// a one-line summary of each, and botsHide leaves them out. A comment is from
+// a bot if GitHub says its author is one, if its author's login matches one of
+// the globs in git config re.bots.login, or if it contains one of the strings
+// in git config re.bots.marker.
+const (
+	botsShow     = "show"
+	botsCollapse = "collapse"
+	botsHide     = "hide"
+)
+
+// botFilter is the parsed bot configuration.
+type botFilter struct {
+	mode    string
+	logins  []string
+	markers []string
+}
+
+var bots *botFilter
+
+// botConfig returns the bot configuration.
+func botConfig() *botFilter {
+	if bots != nil {
+		return bots
+	}
+	mode := *botMode
+	if mode == "" {
+		mode = gitConfig("re.bots.mode")
+	}
+	switch mode {
+	case "":
+		mode = botsCollapse
+	case botsShow, botsCollapse, botsHide:
+	default:
+		log.Fatalf("invalid bot mode %q: must be show, collapse or hide", mode)
+	}
+	bots = &botFilter{
+		mode:    mode,
+		logins:  gitConfigAll("re.bots.login"),
+		markers: gitConfigAll("re.bots.marker"),
+	}
+	return bots
+}
+
+// isBot reports whether a comment by user with body is from a bot.
+func (b *botFilter) isBot(user *github.User, body string) bool {
+	if user.GetType() == "Bot" {
+		return true
+	}
+	login := user.GetLogin()
+	for _, pattern := range b.logins {
+		if ok, _ := path.Match(pattern, login); ok {
+			return true
+		}
+	}
+	for _, marker := range b.markers {
+		if marker != "" && strings.Contains(body, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// botSummary returns a one-line summary of a bot's comment: its first line of
+// text, shortened if need be.
+func botSummary(body string) string {
+	summary := ""
+	for _, line := range strings.Split(renderMarkdown(body, ""), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			summary = line
+			break
+		}
+	}
+	if max := wrapWidth(); utf8.RuneCountInString(summary) > max {
+		summary = string([]rune(summary)[:max-1]) + "…"
+	}
+	return "[bot] " + summary
+}
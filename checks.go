@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/go-github/github"
+)
+
+// The Checks API postdates our go-github, so check runs are fetched by hand.
+const mediaTypeChecksPreview = "application/vnd.github.antiope-preview+json"
+
+type checkRun struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+	HTMLURL    string `json:"html_url"`
+	DetailsURL string `json:"details_url"`
+	Output     struct {
+		Title            string `json:"title"`
+		Summary          string `json:"summary"`
+		AnnotationsCount int    `json:"annotations_count"`
+	} `json:"output"`
+}
+
+func listCheckRuns(ctx context.Context, owner, repo, ref string) ([]*checkRun, error) {
+	var runs []*checkRun
+	for page := 1; ; {
+		u := fmt.Sprintf("repos/%s/%s/commits/%s/check-runs?per_page=100&page=%d", owner, repo, ref, page)
+		req, err := client.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", mediaTypeChecksPreview)
+		var list struct {
+			CheckRuns []*checkRun `json:"check_runs"`
+		}
+		resp, err := client.Do(ctx, req, &list)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, list.CheckRuns...)
+		if resp.NextPage < page {
+			break
+		}
+		page = resp.NextPage
+	}
+	return runs, nil
+}
+
+// CI rollup states, matching the states of GitHub's combined status.
+const (
+	ciSuccess = "success"
+	ciFailure = "failure"
+	ciPending = "pending"
+)
+
+// ciRollup combines the commit statuses and check runs on ref into a single
+// state, or "" if there are none of either.
+func ciRollup(ctx context.Context, owner, repo, ref string) (string, error) {
+	combined, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, ref,
+		&github.ListOptions{PerPage: 100})
+	if err != nil {
+		return "", err
+	}
+	runs, err := listCheckRuns(ctx, owner, repo, ref)
+	if err != nil {
+		return "", err
+	}
+	state := ""
+	if getInt(combined.TotalCount) > 0 {
+		state = getString(combined.State)
+		if state == "error" {
+			state = ciFailure
+		}
+	}
+	for _, run := range runs {
+		state = worseCIState(state, checkRunState(run))
+	}
+	return state, nil
+}
+
+func checkRunState(run *checkRun) string {
+	if run.Status != "completed" {
+		return ciPending
+	}
+	switch run.Conclusion {
+	case "success", "neutral", "skipped":
+		return ciSuccess
+	default:
+		return ciFailure
+	}
+}
+
+// ciSymbol returns the symbol for a CI state.
+func ciSymbol(state string) string {
+	switch state {
+	case ciSuccess:
+		return "✓"
+	case ciFailure:
+		return "✗"
+	case ciPending:
+		return "●"
+	}
+	return " "
+}
+
+func worseCIState(a, b string) string {
+	for _, s := range []string{ciFailure, ciPending, ciSuccess} {
+		if a == s || b == s {
+			return s
+		}
+	}
+	return ""
+}
+
+type checkAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Title           string `json:"title"`
+	Message         string `json:"message"`
+	// run is the name of the check run the annotation is from.
+	run string
+}
+
+func listAnnotations(ctx context.Context, owner, repo string, run *checkRun) ([]*checkAnnotation, error) {
+	var annotations []*checkAnnotation
+	for page := 1; ; {
+		u := fmt.Sprintf("repos/%s/%s/check-runs/%d/annotations?per_page=100&page=%d", owner, repo, run.ID, page)
+		req, err := client.NewRequest("GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", mediaTypeChecksPreview)
+		var list []*checkAnnotation
+		resp, err := client.Do(ctx, req, &list)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range list {
+			a.run = run.Name
+		}
+		annotations = append(annotations, list...)
+		if resp.NextPage < page {
+			break
+		}
+		page = resp.NextPage
+	}
+	return annotations, nil
+}
+
+// prChecks is the CI state of a PR's head commit.
+type prChecks struct {
+	statuses    []github.RepoStatus
+	runs        []*checkRun
+	annotations []*checkAnnotation
+}
+
+// fetchChecks fetches the commit statuses and check runs on ref, and with
+// -annotations, the annotations of the failed check runs.
+func fetchChecks(ctx context.Context, owner, repo, ref string) (*prChecks, error) {
+	combined, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, ref,
+		&github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, err
+	}
+	c := &prChecks{statuses: combined.Statuses}
+	if c.runs, err = listCheckRuns(ctx, owner, repo, ref); err != nil {
+		return nil, err
+	}
+	if !*showAnnotations {
+		return c, nil
+	}
+	for _, run := range c.runs {
+		if checkRunState(run) != ciFailure || run.Output.AnnotationsCount == 0 {
+			continue
+		}
+		annotations, err := listAnnotations(ctx, owner, repo, run)
+		if err != nil {
+			return nil, err
+		}
+		c.annotations = append(c.annotations, annotations...)
+	}
+	return c, nil
+}
+
+// format lays out the checks as a table of names, results and links, with
+// failures first.
+func (c *prChecks) format() string {
+	type check struct {
+		state, name, result, url string
+	}
+	var checks []check
+	for _, s := range c.statuses {
+		state := getString(s.State)
+		if state == "error" {
+			state = ciFailure
+		}
+		checks = append(checks, check{state, getString(s.Context), getString(s.State), getString(s.TargetURL)})
+	}
+	for _, run := range c.runs {
+		result := run.Conclusion
+		if run.Status != "completed" {
+			result = run.Status
+		}
+		url := run.HTMLURL
+		if url == "" {
+			url = run.DetailsURL
+		}
+		checks = append(checks, check{checkRunState(run), run.Name, result, url})
+	}
+	if len(checks) == 0 {
+		return ""
+	}
+	order := map[string]int{ciFailure: 0, ciPending: 1, ciSuccess: 2}
+	sort.SliceStable(checks, func(i, j int) bool {
+		if order[checks[i].state] != order[checks[j].state] {
+			return order[checks[i].state] < order[checks[j].state]
+		}
+		return checks[i].name < checks[j].name
+	})
+
+	var b strings.Builder
+	b.WriteString("Checks:\n")
+	writer := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	for _, c := range checks {
+		fmt.Fprintf(writer, "  %s %s\t%s\t%s\n", ciSymbol(c.state), c.name, c.result, c.url)
+	}
+	if err := writer.Flush(); err != nil {
+		panic(err)
+	}
+	return b.String()
+}
+
+// placeAnnotations finds where in diff, a series of commits with their diffs,
+// each annotation goes: on the last line of the diffs of its file that shows
+// the line it starts on in the new file.
+func (c *prChecks) placeAnnotations(diff string) map[diffPosition][]*checkAnnotation {
+	if c == nil || len(c.annotations) == 0 {
+		return nil
+	}
+	at := newLinePositions(diff)
+	placed := make(map[diffPosition][]*checkAnnotation)
+	for _, a := range c.annotations {
+		if pos, ok := at[fileLine{a.Path, a.StartLine}]; ok {
+			placed[pos] = append(placed[pos], a)
+		}
+	}
+	return placed
+}
+
+// writeAnnotations writes annotations as an inline comment block. They can't
+// be replied to, since they aren't GitHub threads.
+func writeAnnotations(w io.Writer, annotations []*checkAnnotation) {
+	fmt.Fprintf(w, "%s\n", inlineStartMarker)
+	for _, a := range annotations {
+		lines := fmt.Sprintf("line %d", a.StartLine)
+		if a.EndLine > a.StartLine {
+			lines = fmt.Sprintf("lines %d-%d", a.StartLine, a.EndLine)
+		}
+		fmt.Fprintf(w, "* Check %s %s on %s\n", a.run, a.AnnotationLevel, lines)
+		text := a.Message
+		if a.Title != "" {
+			text = a.Title + "\n" + text
+		}
+		fmt.Fprintf(w, "*\t%s\n", renderMarkdown(text, "*\t"))
+	}
+	fmt.Fprintf(w, "%s\n", inlineEndMarker)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// codeOwnersPaths are where GitHub looks for a CODEOWNERS file, in the order
+// it looks.
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// ownersAnnotation starts the line under a file's header in the template
+// listing the file's code owners.
+const ownersAnnotation = "# owners: "
+
+type codeOwnersRule struct {
+	pattern pathPattern
+	owners  []string
+}
+
+// codeOwners is a parsed CODEOWNERS file.
+type codeOwners []codeOwnersRule
+
+// parseCodeOwners parses a CODEOWNERS file. Its patterns are like those of
+// -include and -exclude.
+func parseCodeOwners(text string) codeOwners {
+	var rules codeOwners
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rules = append(rules, codeOwnersRule{compilePathPattern(fields[0]), fields[1:]})
+	}
+	return rules
+}
+
+// fetchCodeOwners fetches and parses the CODEOWNERS file as of ref, returning
+// nil if there isn't one.
+func fetchCodeOwners(ctx context.Context, ref string) (codeOwners, error) {
+	for _, path := range codeOwnersPaths {
+		content, _, resp, err := client.Repositories.GetContents(ctx, projectOwner, projectRepo, path,
+			&github.RepositoryContentGetOptions{Ref: ref})
+		if resp != nil && resp.StatusCode == 404 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if content == nil {
+			continue
+		}
+		text, err := content.GetContent()
+		if err != nil {
+			return nil, err
+		}
+		return parseCodeOwners(text), nil
+	}
+	return nil, nil
+}
+
+// ownersOf returns the owners of path, as given by the last rule that matches
+// it.
+func (c codeOwners) ownersOf(path string) []string {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].pattern.match(path) {
+			return c[i].owners
+		}
+	}
+	return nil
+}
+
+// fetchMyOwnerNames returns the names you can be a code owner by: your login
+// and each of your teams, as they're written in CODEOWNERS.
+func fetchMyOwnerNames(ctx context.Context) (map[string]bool, error) {
+	names := map[string]bool{"@" + strings.ToLower(currentUser): true}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		teams, resp, err := client.Organizations.ListUserTeams(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range teams {
+			names[strings.ToLower(fmt.Sprintf("@%s/%s", t.GetOrganization().GetLogin(), t.GetSlug()))] = true
+		}
+		if resp.NextPage == 0 {
+			return names, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// ownedByMe reports whether you or one of your teams owns path.
+func (d *prData) ownedByMe(path string) bool {
+	for _, owner := range d.owners.ownersOf(path) {
+		if d.myOwnerNames[strings.ToLower(owner)] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// editorFiles holds the editor integrations for the review template, which
+// has the filetype rereview.
+//
+//go:embed editor
+var editorFiles embed.FS
+
+// editorTarget is an editor that re editor install knows how to set up.
+type editorTarget struct {
+	// src is the directory of editorFiles to install.
+	src string
+	// dir returns the directory to install into.
+	dir func(home string) string
+}
+
+var editorTargets = map[string]editorTarget{
+	"vim": {"editor/vim", func(home string) string {
+		return filepath.Join(home, ".vim")
+	}},
+	"nvim": {"editor/vim", func(home string) string {
+		config := os.Getenv("XDG_CONFIG_HOME")
+		if config == "" {
+			config = filepath.Join(home, ".config")
+		}
+		return filepath.Join(config, "nvim")
+	}},
+	"vscode": {"editor/vscode", func(home string) string {
+		return filepath.Join(home, ".vscode", "extensions", "re.rereview-0.1.0")
+	}},
+}
+
+func editorUsage() {
+	fmt.Fprintf(os.Stderr, `usage: re editor install [vim] [nvim] [vscode]
+
+Installs highlighting, and for vim and neovim folding by file, for re's review
+templates. With no editors named, installs for each of vim, neovim and VS Code
+that has a configuration directory.
+`)
+	os.Exit(2)
+}
+
+// editorCmd runs re editor.
+func editorCmd(args []string) {
+	if len(args) == 0 || args[0] != "install" {
+		editorUsage()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	names := args[1:]
+	if len(names) == 0 {
+		for _, name := range []string{"vim", "nvim", "vscode"} {
+			dir := editorTargets[name].dir(home)
+			if name == "vscode" {
+				dir = filepath.Join(home, ".vscode")
+			}
+			if _, err := os.Stat(dir); err == nil {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			log.Fatal("no vim, neovim or VS Code configuration found; name the editor to install for")
+		}
+	}
+	for _, name := range names {
+		target, ok := editorTargets[name]
+		if !ok {
+			editorUsage()
+		}
+		dir := target.dir(home)
+		if err := installEditorFiles(target.src, dir); err != nil {
+			log.Fatal(fmt.Errorf("installing %s support: %v", name, err))
+		}
+		fmt.Printf("Installed %s support in %s\n", name, dir)
+	}
+}
+
+// installEditorFiles copies the files under src in editorFiles into dir.
+func installEditorFiles(src, dir string) error {
+	return fs.WalkDir(editorFiles, src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := p[len(src):]
+		dest := filepath.Join(dir, filepath.FromSlash(rel))
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+		data, err := editorFiles.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dest, data, 0644)
+	})
+}
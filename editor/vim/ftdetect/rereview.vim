@@ -0,0 +1,2 @@
+" Review templates written by re (https://github.com/jordanlewis/re).
+autocmd BufNewFile,BufRead re-edit-*.re,*/re-edit-*/*.re,*.redraft,*.redraft/*.re set filetype=rereview
@@ -0,0 +1,49 @@
+" Vim filetype plugin
+" Language:	re review template
+" Maintainer:	https://github.com/jordanlewis/re
+
+if exists("b:did_ftplugin") && b:did_ftplugin ==# "rereview"
+  finish
+endif
+let b:did_ftplugin = "rereview"
+
+" Fold each file's diff, along with the comments on it. Folds start open;
+" use zM to close them all and get an overview of the files.
+function! RereviewFold(lnum) abort
+  let line = getline(a:lnum)
+  if line =~# '^diff --git '
+    return '>1'
+  elseif line =~# '^commit \x\+$' || line =~# '^# vim: set filetype='
+    return '0'
+  endif
+  return '='
+endfunction
+
+function! RereviewFoldText() abort
+  let file = matchstr(getline(v:foldstart), '^diff --git a/.\{-} b/\zs.*$')
+  let comments = 0
+  for line in getline(v:foldstart, v:foldend)
+    if line =~# '^\* Comment by '
+      let comments += 1
+    endif
+  endfor
+  let text = file . ' (' . (v:foldend - v:foldstart + 1) . ' lines'
+  if comments > 0
+    let text .= ', ' . comments . ' comment' . (comments == 1 ? '' : 's')
+  endif
+  return text . ')'
+endfunction
+
+setlocal foldmethod=expr
+setlocal foldexpr=RereviewFold(v:lnum)
+setlocal foldtext=RereviewFoldText()
+setlocal foldlevel=99
+" Comments are free text; don't wrap or continue diff lines as you type.
+setlocal textwidth=0 formatoptions-=t formatoptions-=c formatoptions-=r formatoptions-=o
+
+" ]f and [f move to the next and previous file.
+nnoremap <buffer> <silent> ]f :call search('^diff --git ', 'W')<CR>
+nnoremap <buffer> <silent> [f :call search('^diff --git ', 'bW')<CR>
+
+let b:undo_ftplugin = "setlocal foldmethod< foldexpr< foldtext< foldlevel< textwidth< formatoptions<"
+      \ . " | silent! nunmap <buffer> ]f | silent! nunmap <buffer> [f"
@@ -0,0 +1,73 @@
+" Vim syntax file
+" Language:	re review template
+" Maintainer:	https://github.com/jordanlewis/re
+
+if exists("b:current_syntax") && b:current_syntax ==# "rereview"
+  finish
+endif
+
+" The template declares itself as git.rereview, so that it still gets git's
+" highlighting without this plugin. Start over, since everything is defined
+" here.
+syntax clear
+
+" Anything not otherwise matched after the first diff, or between the
+" top-level markers, is a comment being written.
+syn region  rereviewDiff        start=/^diff --git / end=/\%$/ contains=@rereviewDiffItems
+syn region  rereviewTopLevel    matchgroup=rereviewMarker start=/^# ------ BEGIN  TOP-LEVEL REVIEW COMMENTS ----- #$/ end=/^# ------ END OF TOP-LEVEL REVIEW COMMENTS ----- #$/ contains=rereviewNewComment
+
+syn cluster rereviewDiffItems   contains=rereviewNewComment,rereviewCommit,rereviewCommitHeader,rereviewCommitMessage,rereviewFile,rereviewFileHeader,rereviewHunk,rereviewAdded,rereviewRemoved,rereviewContext,rereviewExpanded,rereviewExpandedHunk,rereviewThreadMarker,rereviewThreadHeader,rereviewExisting,rereviewModeline
+
+syn match   rereviewNewComment  /^[^-+ =@*\t].*$/ contained
+syn match   rereviewCommit      /^commit \x\+$/
+syn match   rereviewCommitHeader /^\(Author\|Date\|Title\|State\|Merged\|Closed\|URL\):.*$/ contains=rereviewHeaderKey
+syn match   rereviewHeaderKey   /^\w\+:/ contained
+syn match   rereviewCommitMessage /^    .*$/
+syn match   rereviewFile        /^diff --git .*$/ contained
+syn match   rereviewFileHeader  /^\(index\|new file\|deleted file\|similarity\|rename\|old mode\|new mode\|--- \|+++ \).*$/ contained
+syn match   rereviewHunk        /^@@ .*$/ contained
+syn match   rereviewAdded       /^+.*$/ contained
+syn match   rereviewRemoved     /^-.*$/ contained
+syn match   rereviewContext     /^ .*$/ contained
+syn match   rereviewExpanded    /^=.*$/ contained
+syn match   rereviewExpandedHunk /^=@@ .*$/ contained
+syn match   rereviewThreadMarker /^\*\{79}[v^]$/ contained
+syn match   rereviewThreadHeader /^\* Comment by .*$/ contained contains=rereviewThreadId
+syn match   rereviewThreadId    /thread \d\+$/ contained
+syn match   rereviewExisting    /^\*\t.*$/ contained
+syn match   rereviewInstructions /^#.*$/
+syn match   rereviewModeline    /^# vim: set filetype=git\.rereview:$/
+syn match   rereviewMarker      /^# ------ \(BEGIN  \|END OF \)TOP-LEVEL REVIEW COMMENTS ----- #$/
+
+" The conversation in the header.
+syn match   rereviewConversation /^\(Comment\|Approved\|Changes requested\|Draft comment\|Created\) by .*$/
+syn match   rereviewQuoted      /^\t.*$/
+
+hi def link rereviewNewComment    Special
+hi def link rereviewCommit        Statement
+hi def link rereviewCommitHeader  Normal
+hi def link rereviewHeaderKey     Keyword
+hi def link rereviewCommitMessage String
+hi def link rereviewFile          Type
+hi def link rereviewFileHeader    Type
+hi def link rereviewHunk          PreProc
+hi def link rereviewAdded         diffAdded
+hi def link rereviewRemoved       diffRemoved
+hi def link rereviewContext       Normal
+hi def link rereviewExpanded      Comment
+hi def link rereviewExpandedHunk  PreProc
+hi def link rereviewThreadMarker  Comment
+hi def link rereviewThreadHeader  Identifier
+hi def link rereviewThreadId      Number
+hi def link rereviewExisting      Comment
+hi def link rereviewInstructions  Comment
+hi def link rereviewModeline      Comment
+hi def link rereviewMarker        Todo
+hi def link rereviewConversation  Identifier
+hi def link rereviewQuoted        String
+hi def link diffAdded             DiffAdd
+hi def link diffRemoved           DiffDelete
+
+syn sync fromstart
+
+let b:current_syntax = "rereview"
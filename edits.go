@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Your own comments and reviews are shown in the template as you wrote them,
+// between *edit N and *end N lines, where N is the comment's or review's ID,
+// so that they can be edited in place. Replacing a comment's text with
+// /delete deletes it; reviews can't be deleted. Edits are found by comparing
+// the template against the original, and made when the review is submitted.
+
+var (
+	editStart = regexp.MustCompile(`^\*edit (\d+)$`)
+	editEnd   = regexp.MustCompile(`^\*end (\d+)$`)
+)
+
+const deleteComment = "/delete"
+
+// parsedEdit is a change to one of your comments, in the PR's conversation or
+// inline, or to one of your reviews, as given by Kind.
+type parsedEdit struct {
+	Kind   string `json:"kind"`
+	ID     int    `json:"id"`
+	Body   string `json:"body,omitempty"`
+	Delete bool   `json:"delete,omitempty"`
+}
+
+// writeEditable writes your comment with id as an editable block.
+func writeEditable(w io.Writer, id int, body string) {
+	body = strings.TrimRight(strings.Replace(body, "\r\n", "\n", -1), "\n")
+	fmt.Fprintf(w, "*edit %d\n%s\n*end %d\n", id, body, id)
+}
+
+// commentEdits returns the edits in edited whose text differs from that in
+// orig, the edits as the template was generated.
+func commentEdits(edited, orig []*parsedEdit) []*parsedEdit {
+	type key struct {
+		kind string
+		id   int
+	}
+	was := make(map[key]string)
+	for _, e := range orig {
+		was[key{e.Kind, e.ID}] = e.Body
+	}
+	var changed []*parsedEdit
+	for _, e := range edited {
+		body, ok := was[key{e.Kind, e.ID}]
+		if !ok || body == e.Body {
+			continue
+		}
+		if strings.TrimSpace(e.Body) == deleteComment {
+			e = &parsedEdit{Kind: e.Kind, ID: e.ID, Delete: true}
+		}
+		changed = append(changed, e)
+	}
+	return changed
+}
+
+// describe describes the edit, for the preview and summary.
+func (e *parsedEdit) describe() string {
+	what := fmt.Sprintf("comment %d", e.ID)
+	switch e.Kind {
+	case targetReviewComment:
+		what = "inline " + what
+	case targetReview:
+		what = fmt.Sprintf("review %d", e.ID)
+	}
+	if e.Delete {
+		return "Delete " + what
+	}
+	return "Edit " + what
+}
+
+// applyEdits edits and deletes your comments, and edits your reviews, on PR n.
+func applyEdits(ctx context.Context, n int, edits []*parsedEdit) error {
+	for _, e := range edits {
+		var err error
+		switch {
+		case e.Kind == targetReview:
+			err = editReview(ctx, n, e.ID, e.Body)
+		case e.Kind == targetIssueComment && e.Delete:
+			_, err = client.Issues.DeleteComment(ctx, projectOwner, projectRepo, e.ID)
+		case e.Kind == targetIssueComment:
+			_, _, err = client.Issues.EditComment(ctx, projectOwner, projectRepo, e.ID,
+				&github.IssueComment{Body: &e.Body})
+		case e.Delete:
+			_, err = client.PullRequests.DeleteComment(ctx, projectOwner, projectRepo, e.ID)
+		default:
+			_, _, err = client.PullRequests.EditComment(ctx, projectOwner, projectRepo, e.ID,
+				&github.PullRequestComment{Body: &e.Body})
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", strings.ToLower(e.describe()), err)
+		}
+		switch {
+		case e.Kind == targetReview:
+			fmt.Printf("Edited review %d\n", e.ID)
+		case e.Delete:
+			fmt.Printf("Deleted comment %d\n", e.ID)
+		default:
+			fmt.Printf("Edited comment %d\n", e.ID)
+		}
+	}
+	return nil
+}
+
+// editReview replaces the body of review id on PR n, which our go-github
+// can't do.
+func editReview(ctx context.Context, n, id int, body string) error {
+	req, err := client.NewRequest("PUT", fmt.Sprintf("repos/%s/%s/pulls/%d/reviews/%d", projectOwner, projectRepo, n, id),
+		map[string]string{"body": body})
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(ctx, req, nil)
+	return err
+}
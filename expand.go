@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/github"
+)
+
+// Lines of a file shown around the diff's hunks with -context, -func or
+// -expand are prefixed with "=", and each run of them is introduced by an
+// expandedStart line giving the line number in the new file that it starts
+// at. They aren't part of the diff GitHub knows about, so they take up no
+// positions; comments on them go on the nearest line of the diff instead.
+const expandedStart = "=@@"
+
+var expandedHeader = regexp.MustCompile(`^=@@ \+(\d+),(\d+) @@$`)
+
+// hunkRange matches a hunk header, capturing the hunk's first line in the new
+// file, the number of new lines it covers, and the section heading git found
+// for it, if any.
+var hunkRange = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// expanding reports whether any of -context, -func or -expand were given.
+func expanding() bool {
+	return *contextLines > 0 || *funcContext || *expandFiles
+}
+
+type diffHunk struct {
+	header string
+	// first and last are the range of lines of the new file the hunk covers,
+	// which is empty if last < first.
+	first, last int
+	heading     string
+	lines       []string
+}
+
+// fileDiff is a commit's diff of a single file.
+type fileDiff struct {
+	commit string
+	path   string
+	header []string
+	hunks  []*diffHunk
+	// src holds the file as of commit, if it could be fetched.
+	src []string
+}
+
+// expandDiff adds lines of context from each changed file to diff, a series
+// of commits with their diffs, as asked for by -context, -func and -expand.
+func expandDiff(ctx context.Context, diff string) string {
+	// Split the diff into file diffs, with the lines between them, like
+	// commit headers, kept in order as they are.
+	type part struct {
+		lines []string
+		file  *fileDiff
+	}
+	var parts []*part
+	other := &part{}
+	parts = append(parts, other)
+	commit := ""
+	var fd *fileDiff
+	var h *diffHunk
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		if h != nil {
+			if line != "" && strings.IndexByte(" +-\\", line[0]) >= 0 {
+				h.lines = append(h.lines, line)
+				continue
+			}
+			h = nil
+		}
+		if m := commitStart.FindStringSubmatch(line); m != nil {
+			commit = m[1]
+			fd = nil
+		}
+		if strings.HasPrefix(line, diffStart) {
+			fd = &fileDiff{commit: commit}
+			parts = append(parts, &part{file: fd})
+			other = &part{}
+			parts = append(parts, other)
+		}
+		if fd == nil {
+			other.lines = append(other.lines, line)
+			continue
+		}
+		if m := hunkRange.FindStringSubmatch(line); m != nil {
+			first, _ := strconv.Atoi(m[1])
+			count := 1
+			if m[2] != "" {
+				count, _ = strconv.Atoi(m[2])
+			}
+			h = &diffHunk{header: line, first: first, last: first + count - 1, heading: m[3]}
+			if count == 0 {
+				// An empty range is given as the line before it.
+				h.first++
+			}
+			fd.hunks = append(fd.hunks, h)
+			continue
+		}
+		if len(fd.hunks) > 0 {
+			// The file's diff is over; what's left goes after it.
+			fd = nil
+			other.lines = append(other.lines, line)
+			continue
+		}
+		if m := fileStart.FindStringSubmatch(line); m != nil {
+			fd.path = m[1]
+		}
+		fd.header = append(fd.header, line)
+	}
+
+	// Fetch the files, as of each commit.
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for _, p := range parts {
+		if p.file == nil || p.file.path == "" || len(p.file.hunks) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(fd *fileDiff) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			content, _, _, err := client.Repositories.GetContents(ctx, projectOwner, projectRepo, fd.path,
+				&github.RepositoryContentGetOptions{Ref: fd.commit})
+			if err == nil && content == nil {
+				err = fmt.Errorf("not a file")
+			}
+			var text string
+			if err == nil {
+				text, err = content.GetContent()
+			}
+			if err != nil {
+				log.Printf("can't show context for %s at %.7s: %v", fd.path, fd.commit, err)
+				return
+			}
+			fd.src = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+		}(p.file)
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	for _, p := range parts {
+		if p.file != nil {
+			p.file.write(&b)
+		}
+		for _, line := range p.lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// write writes the file diff, with the lines of context around its hunks
+// that were asked for.
+func (fd *fileDiff) write(b *strings.Builder) {
+	for _, line := range fd.header {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	shown := 0
+	// Context after a hunk is held back and written along with the context
+	// before the next, so that runs of lines that meet share a header.
+	var after []int
+	for i, h := range fd.hunks {
+		fd.writeExpanded(b, append(after, fd.contextBefore(h, shown)...))
+		b.WriteString(h.header)
+		b.WriteByte('\n')
+		for _, line := range h.lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+		if h.last > shown {
+			shown = h.last
+		}
+		// Context after a hunk that's also before the next one is shown
+		// just once, before the next.
+		after = nil
+		next := len(fd.src) + 1
+		if i+1 < len(fd.hunks) {
+			next = fd.hunks[i+1].first
+		}
+		for _, n := range fd.contextAfter(h) {
+			if n > shown && n < next {
+				after = append(after, n)
+			}
+		}
+		if len(after) > 0 {
+			shown = after[len(after)-1]
+		}
+	}
+	fd.writeExpanded(b, after)
+}
+
+// contextBefore returns the lines to show before h, given that lines up to
+// shown have been already.
+func (fd *fileDiff) contextBefore(h *diffHunk, shown int) []int {
+	if fd.src == nil {
+		return nil
+	}
+	from := shown + 1
+	lines := make(map[int]bool)
+	switch {
+	case *expandFiles:
+		for n := from; n < h.first; n++ {
+			lines[n] = true
+		}
+	case *contextLines > 0:
+		for n := h.first - *contextLines; n < h.first; n++ {
+			if n >= from {
+				lines[n] = true
+			}
+		}
+	}
+	if *funcContext {
+		if n := fd.enclosingFunc(h); n >= from && n < h.first {
+			lines[n] = true
+		}
+	}
+	var ns []int
+	for n := from; n < h.first && n <= len(fd.src); n++ {
+		if lines[n] {
+			ns = append(ns, n)
+		}
+	}
+	return ns
+}
+
+// contextAfter returns the lines to show after h.
+func (fd *fileDiff) contextAfter(h *diffHunk) []int {
+	if fd.src == nil {
+		return nil
+	}
+	to := h.last + *contextLines
+	if *expandFiles {
+		to = len(fd.src)
+	}
+	var ns []int
+	for n := h.last + 1; n <= to && n <= len(fd.src); n++ {
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+// enclosingFunc returns the line of the function or other section that h is
+// in: the line git gave as the hunk's heading, or failing that, the nearest
+// line above the hunk that starts with a letter, _ or $, which is git's
+// default notion of a function header.
+func (fd *fileDiff) enclosingFunc(h *diffHunk) int {
+	heading := strings.TrimSpace(h.heading)
+	for n := h.first - 1; n >= 1 && n <= len(fd.src); n-- {
+		line := fd.src[n-1]
+		if heading != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), heading) {
+				return n
+			}
+			continue
+		}
+		if line != "" && (line[0] == '_' || line[0] == '$' ||
+			('a' <= line[0] && line[0] <= 'z') || ('A' <= line[0] && line[0] <= 'Z')) {
+			return n
+		}
+	}
+	return 0
+}
+
+// writeExpanded writes the given lines of the file, in runs of consecutive
+// lines, each introduced by a header.
+func (fd *fileDiff) writeExpanded(b *strings.Builder, ns []int) {
+	for i := 0; i < len(ns); {
+		j := i + 1
+		for j < len(ns) && ns[j] == ns[j-1]+1 {
+			j++
+		}
+		fmt.Fprintf(b, "%s +%d,%d @@\n", expandedStart, ns[i], j-i)
+		for _, n := range ns[i:j] {
+			b.WriteByte('=')
+			b.WriteString(fd.src[n-1])
+			b.WriteByte('\n')
+		}
+		i = j
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// expandedTemplate is a file's diff with expanded context before, between
+// and after its hunks, commented on throughout.
+var expandedTemplate = strings.Join([]string{
+	topLevelStartMarker,
+	topLevelEndMarker,
+	"",
+	"commit aaaa",
+	"",
+	"diff --git a/foo.go b/foo.go",
+	"--- a/foo.go",
+	"+++ b/foo.go",
+	"=@@ +1,2 @@",
+	"=package foo",
+	"On the package.",
+	"=",
+	"@@ -3,2 +3,3 @@",
+	" a",
+	"+b",
+	"On b.",
+	" c",
+	"=@@ +6,2 @@",
+	"=d",
+	"On d.",
+	"=e",
+	"@@ -9,1 +10,2 @@",
+	" f",
+	"+g",
+	"=@@ +12,1 @@",
+	"=h",
+	"On h.",
+	templateModeline,
+	"",
+}, "\n")
+
+func TestExpandedCommentPositions(t *testing.T) {
+	parsed, err := parseFile([]byte(expandedTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote := func(line int, text string) string {
+		return fmt.Sprintf("Line %d:\n```\n%s\n```\n\n", line, text)
+	}
+	// The diff's lines take up positions 1-3 for the first hunk, then 4 for
+	// the second's header and 5-6 for its lines; expanded context takes up
+	// none.
+	want := []struct {
+		position int
+		line     int
+		body     string
+	}{
+		// With no diff line above it, a comment goes on the first.
+		{1, 1, quote(1, "package foo") + "On the package."},
+		{2, 4, "On b."},
+		{3, 6, quote(6, "d") + "On d."},
+		{6, 12, quote(12, "h") + "On h."},
+	}
+	comments := parsed.Request.Comments
+	if len(comments) != len(want) {
+		t.Fatalf("got %d comments, want %d", len(comments), len(want))
+	}
+	for i, w := range want {
+		c := comments[i]
+		if c.GetPosition() != w.position || c.GetBody() != w.body || parsed.Comments[i].Line != w.line {
+			t.Errorf("comment %d at position %d, line %d, with body %q; want position %d, line %d, with body %q",
+				i, c.GetPosition(), parsed.Comments[i].Line, c.GetBody(), w.position, w.line, w.body)
+		}
+	}
+}
+
+func TestWriteExpandedMergesRuns(t *testing.T) {
+	defer func(n int) { *contextLines = n }(*contextLines)
+	*contextLines = 2
+	var src []string
+	for i := 1; i <= 20; i++ {
+		src = append(src, fmt.Sprint("line ", i))
+	}
+	fd := &fileDiff{src: src, hunks: []*diffHunk{
+		{header: "@@ -1,5 +1,5 @@", first: 1, last: 5},
+		{header: "@@ -10,3 +10,3 @@", first: 10, last: 12},
+	}}
+	var b strings.Builder
+	fd.write(&b)
+	// The context after the first hunk, lines 6 and 7, meets that before the
+	// second, 8 and 9, so they share a header.
+	want := strings.Join([]string{
+		"@@ -1,5 +1,5 @@",
+		"=@@ +6,4 @@",
+		"=line 6",
+		"=line 7",
+		"=line 8",
+		"=line 9",
+		"@@ -10,3 +10,3 @@",
+		"=@@ +13,2 @@",
+		"=line 13",
+		"=line 14",
+		"",
+	}, "\n")
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// eventName describes what submitting the review will do.
+func (r *parsedReview) eventName() string {
+	if r.Request.Event == nil {
+		return "draft"
+	}
+	switch *r.Request.Event {
+	case reviewApprove:
+		return "approve"
+	case reviewRequestChanges:
+		return "request changes"
+	}
+	return "comment"
+}
+
+// preview writes a human-readable rendering of the review to w: the
+// top-level body as it will be posted, then each inline comment under the
+// diff lines it's attached to.
+func (r *parsedReview) preview(w io.Writer) {
+	fmt.Fprintf(w, "%s %s\n", color.HiWhiteString("Review:"), r.eventName())
+	if r.Request.CommitID != nil {
+		fmt.Fprintf(w, "%s %s\n", color.HiWhiteString("Commit:"), *r.Request.CommitID)
+	}
+	if body := getString(r.Request.Body); body != "" {
+		fmt.Fprintf(w, "\n%s\n\n", color.HiWhiteString("Top-level comment:"))
+		fmt.Fprintf(w, "    %s\n", strings.Replace(body, "\n", "\n    ", -1))
+	}
+	paths := make([]string, 0, len(r.Viewed))
+	for path := range r.Viewed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if r.Viewed[path] {
+			fmt.Fprintf(w, "%s %s\n", color.HiWhiteString("Mark viewed:"), path)
+		} else {
+			fmt.Fprintf(w, "%s %s\n", color.HiWhiteString("Mark not viewed:"), path)
+		}
+	}
+	for _, line := range r.Metadata.describe() {
+		fmt.Fprintln(w, color.HiWhiteString(line))
+	}
+	for _, reaction := range r.Reactions {
+		fmt.Fprintln(w, color.HiWhiteString(reaction.describe()))
+	}
+	for _, reply := range r.Replies {
+		fmt.Fprintln(w, color.HiWhiteString("Reply to @%s:", reply.To))
+		fmt.Fprintf(w, "    %s\n", strings.Replace(reply.text(), "\n", "\n    ", -1))
+	}
+	for _, e := range r.Edits {
+		fmt.Fprintln(w, color.HiWhiteString(e.describe()+":"))
+		if !e.Delete {
+			fmt.Fprintf(w, "    %s\n", strings.Replace(e.Body, "\n", "\n    ", -1))
+		}
+	}
+	for _, c := range r.Comments {
+		fmt.Fprintf(w, "\n%s\n", color.HiWhiteString("%s:%d", c.Path, c.Line))
+		for _, line := range c.Context {
+			fmt.Fprintf(w, "    %s\n", colorDiffLine(line))
+		}
+		for _, line := range strings.Split(strings.TrimRight(c.Body, "\n"), "\n") {
+			fmt.Fprintf(w, "  %s %s\n", color.CyanString(">"), line)
+		}
+	}
+	if len(r.Comments) == 0 && getString(r.Request.Body) == "" {
+		fmt.Fprintln(w, "\n(no comments)")
+	}
+}
+
+func colorDiffLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+"):
+		return color.GreenString("%s", line)
+	case strings.HasPrefix(line, "-"):
+		return color.RedString("%s", line)
+	case strings.HasPrefix(line, "@@"):
+		return color.CyanString("%s", line)
+	}
+	return line
+}
+
+// writePatch writes the review in a patch-like format that can be read
+// without re: each comment follows the diff context it refers to, quoted with
+// "> ".
+func (r *parsedReview) writePatch(w io.Writer) {
+	fmt.Fprintf(w, "# Review: %s\n", r.eventName())
+	if r.Request.CommitID != nil {
+		fmt.Fprintf(w, "# Commit: %s\n", *r.Request.CommitID)
+	}
+	if body := getString(r.Request.Body); body != "" {
+		fmt.Fprintf(w, "\n%s\n", strings.TrimRight(body, "\n"))
+	}
+	for _, c := range r.Comments {
+		fmt.Fprintf(w, "\n--- a/%s\n+++ b/%s\n", c.Path, c.Path)
+		for _, line := range c.Context {
+			fmt.Fprintln(w, line)
+		}
+		for _, line := range strings.Split(strings.TrimRight(c.Body, "\n"), "\n") {
+			fmt.Fprintf(w, "> %s\n", line)
+		}
+	}
+}
+
+// exportFile saves the review to filename, as JSON if the name ends in .json
+// and as a patch otherwise.
+func (r *parsedReview) exportFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(filename, ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	} else {
+		r.writePatch(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
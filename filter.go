@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Path patterns pick which files go in the review template. They're globs,
+// where * and ? don't match /, and ** matches any number of directories. As
+// in .gitignore, a pattern without a / in the middle matches a file or
+// directory of that name anywhere, others match from the root, and a pattern
+// that matches a directory matches everything in it. So *.pb.go leaves out
+// generated protobuf code wherever it is, vendor/** leaves out the vendor
+// directory at the root, and testdata leaves out every testdata directory.
+
+// pathPattern is a compiled path pattern.
+type pathPattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func compilePathPattern(glob string) pathPattern {
+	pattern := strings.TrimSuffix(glob, "/")
+	var re strings.Builder
+	re.WriteString("^")
+	if !strings.Contains(pattern, "/") {
+		re.WriteString("(?:.*/)?")
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("(?:/.*)?$")
+	return pathPattern{glob, regexp.MustCompile(re.String())}
+}
+
+func (p pathPattern) match(path string) bool {
+	return p.re.MatchString(path)
+}
+
+// pathFilter decides which files go in the review template.
+type pathFilter struct {
+	include, exclude []pathPattern
+}
+
+var filter *pathFilter
+
+// pathPatterns returns the patterns given with flag, or if there are none,
+// those in the git config key.
+func pathPatterns(flag []string, key string) []pathPattern {
+	globs := flag
+	if len(globs) == 0 {
+		globs = gitConfigAll(key)
+	}
+	var patterns []pathPattern
+	for _, glob := range globs {
+		if glob != "" {
+			patterns = append(patterns, compilePathPattern(glob))
+		}
+	}
+	return patterns
+}
+
+// pathFilters returns the filter asked for with -include and -exclude, or git
+// config re.include and re.exclude.
+func pathFilters() *pathFilter {
+	if filter == nil {
+		filter = &pathFilter{
+			include: pathPatterns(includePaths, "re.include"),
+			exclude: pathPatterns(excludePaths, "re.exclude"),
+		}
+	}
+	return filter
+}
+
+// omitReason returns why path is left out of the template, or "" if it
+// isn't.
+func (f *pathFilter) omitReason(path string) string {
+	if len(f.include) > 0 {
+		included := false
+		for _, p := range f.include {
+			if p.match(path) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return "not included"
+		}
+	}
+	for _, p := range f.exclude {
+		if p.match(path) {
+			return fmt.Sprintf("excluded by %s", p.glob)
+		}
+	}
+	return ""
+}
+
+// gitConfigAll returns every value of a git config key that may be given more
+// than once.
+func gitConfigAll(key string) []string {
+	out, err := exec.Command("git", "config", "--get-all", key).Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSpace(string(out)), "\n")
+}
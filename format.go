@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"text/template"
+)
+
+// writeFormatted writes v to w according to -format: as indented JSON, or
+// through a Go template. Templates are applied to each element when v is a
+// slice, with a newline after each, so that list output is line-oriented.
+func writeFormatted(w io.Writer, v interface{}, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(format)
+	if err != nil {
+		return fmt.Errorf("parsing -format: %v", err)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		if err := tmpl.Execute(w, v); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := tmpl.Execute(w, rv.Index(i).Interface()); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -8,7 +8,7 @@ require (
 	github.com/google/go-github v14.0.1-0.20171221173707-0c3b302de2a6+incompatible
 	github.com/google/go-querystring v0.0.0-20170111101155-53e6ce116135 // indirect
 	github.com/mattn/go-colorable v0.0.9 // indirect
-	github.com/mattn/go-isatty v0.0.3 // indirect
+	github.com/mattn/go-isatty v0.0.3
 	golang.org/x/net v0.0.0-20171212005608-d866cfc389ce // indirect
 	golang.org/x/oauth2 v0.0.0-20171226133531-197281d4e0ec
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
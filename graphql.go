@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// graphQLURL returns the GraphQL endpoint for projectHost.
+func graphQLURL() string {
+	if projectHost == defaultHost {
+		return "graphql"
+	}
+	return fmt.Sprintf("https://%s/api/graphql", projectHost)
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+// graphQL runs query against the GitHub GraphQL API, unmarshalling the data
+// it returns into out. Some things, like which files you've viewed, can only
+// be done through it.
+func graphQL(ctx context.Context, query string, vars map[string]interface{}, out interface{}) error {
+	body := map[string]interface{}{"query": query, "variables": vars}
+	req, err := client.NewRequest("POST", graphQLURL(), body)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Data   interface{}    `json:"data"`
+		Errors []graphQLError `json:"errors"`
+	}
+	resp.Data = out
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		msgs := make([]string, len(resp.Errors))
+		for i, e := range resp.Errors {
+			msgs[i] = e.Message
+		}
+		return fmt.Errorf("graphql: %s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Jump targets, the places in the review template the editor can be opened
+// at. jumpAuto picks the first unresolved thread if there is one, then the
+// first file you haven't reviewed, then the top-level comments.
+const (
+	jumpAuto     = "auto"
+	jumpTop      = "top"
+	jumpTopLevel = "toplevel"
+	jumpFile     = "file"
+	jumpThread   = "thread"
+)
+
+// jumpTarget returns the jump target asked for with -jump or git config
+// re.jump.
+func jumpTarget() string {
+	target := *jump
+	if target == "" {
+		target = gitConfig("re.jump")
+	}
+	switch target {
+	case "":
+		return jumpAuto
+	case jumpAuto, jumpTop, jumpTopLevel, jumpFile, jumpThread:
+		return target
+	}
+	log.Fatalf("invalid jump target %q: must be auto, top, toplevel, file or thread", target)
+	return ""
+}
+
+// jumpLine returns the line of template to open the editor at for target, or
+// 0 for the top of the file. d is the PR the template was made from; without
+// it, as when resuming a saved draft, only the top-level comments can be
+// found.
+func jumpLine(d *prData, template []byte, target string) int {
+	lines := templateLines(template)
+	// The text of your comments could look like anything, so it's left out.
+	for i, in := range editBlockText(lines) {
+		if in {
+			lines[i] = ""
+		}
+	}
+	switch target {
+	case jumpTopLevel:
+		return topLevelLine(lines)
+	case jumpFile:
+		if d != nil {
+			return d.unreviewedFileLine(lines)
+		}
+	case jumpThread:
+		if d != nil {
+			return d.unresolvedThreadLine(lines)
+		}
+	case jumpAuto:
+		if d != nil {
+			if line := d.unresolvedThreadLine(lines); line != 0 {
+				return line
+			}
+			if d.lastReviewedCommit() != "" {
+				if line := d.unreviewedFileLine(lines); line != 0 {
+					return line
+				}
+			}
+		}
+		return topLevelLine(lines)
+	}
+	return 0
+}
+
+// topLevelLine returns the line of the top-level comment start marker.
+func topLevelLine(lines []string) int {
+	for i, line := range lines {
+		if line == topLevelStartMarker {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// lastReviewedCommit returns the commit of your most recent submitted review,
+// or "" if you haven't reviewed the PR.
+func (d *prData) lastReviewedCommit() string {
+	var last *github.PullRequestReview
+	for _, r := range d.reviews {
+		if getUserLogin(r.User) != currentUser || getString(r.State) == reviewPending {
+			continue
+		}
+		if last == nil || getTime(r.SubmittedAt).After(getTime(last.SubmittedAt)) {
+			last = r
+		}
+	}
+	if last == nil {
+		return ""
+	}
+	return getString(last.CommitID)
+}
+
+// unreviewedFileLine returns the line of the first file diff in a commit
+// newer than the one you last reviewed, or of the first file diff at all if
+// you haven't reviewed the PR or the commit is no longer part of it.
+func (d *prData) unreviewedFileLine(lines []string) int {
+	reviewed := d.lastReviewedCommit()
+	found := false
+	for _, line := range lines {
+		if m := commitStart.FindStringSubmatch(line); m != nil && m[1] == reviewed {
+			found = true
+			break
+		}
+	}
+	unreviewed := !found
+	afterReviewed := false
+	for i, line := range lines {
+		if m := commitStart.FindStringSubmatch(line); m != nil {
+			if afterReviewed {
+				unreviewed = true
+			}
+			afterReviewed = afterReviewed || m[1] == reviewed
+			continue
+		}
+		if unreviewed && strings.HasPrefix(line, diffStart) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// unresolvedThreadLine returns the line of the first inline comment thread
+// whose last comment isn't yours.
+func (d *prData) unresolvedThreadLine(lines []string) int {
+	last := make(map[int]*inlineComment)
+	for _, c := range d.reviewComments {
+		root := threadRoot(c)
+		if l := last[root]; l == nil || !getTime(c.CreatedAt).Before(getTime(l.CreatedAt)) {
+			last[root] = c
+		}
+	}
+	for i, line := range lines {
+		m := threadId.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		id, _ := strconv.Atoi(m[1])
+		if c := last[id]; c != nil && getUserLogin(c.User) != currentUser {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// threadRoot returns the ID of the comment that started c's thread.
+func threadRoot(c *inlineComment) int {
+	if c.InReplyTo != nil {
+		return *c.InReplyTo
+	}
+	return getInt(c.ID)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stringsFlag is a flag that may be given more than once.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string     { return strings.Join(*f, ",") }
+func (f *stringsFlag) Set(s string) error { *f = append(*f, s); return nil }
+
+func listUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, `usage: re list [saved-query] [flags]
+
+Lists pull requests. With no role flags, lists PRs involving you. Role flags
+may be combined; each is searched separately and the results merged.
+
+A saved query is a set of flags stored in git config, for example:
+
+    git config --global re.query.reviews "-requested -org cockroachdb"
+    re list reviews
+
+`)
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+}
+
+// listCmd runs re list, and re with no arguments.
+func listCmd(ctx context.Context, args []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		saved := gitConfig("re.query." + args[0])
+		if saved == "" {
+			log.Fatalf("no saved query named %q (set it with git config re.query.%s)", args[0], args[0])
+		}
+		args = append(strings.Fields(saved), args[1:]...)
+	}
+
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	fs.Usage = listUsage(fs)
+	var (
+		requested = fs.Bool("requested", false, "PRs where your review is requested")
+		authored  = fs.Bool("authored", false, "PRs you authored")
+		mentioned = fs.Bool("mentioned", false, "PRs that mention you")
+		involves  = fs.Bool("involves", false, "PRs involving you in any way (the default)")
+		user      = fs.String("user", currentUser, "search from the point of view of `login`")
+		org       = fs.String("org", "", "search every repo in `org` instead of the current project")
+		state     = fs.String("state", "open", "PR state: open, closed, merged or all")
+		since     = fs.String("since", "1mo", "only PRs updated since `when`, a date like 2006-01-02 or an age like 2w; empty for no limit")
+		until     = fs.String("until", "", "only PRs updated before `when`, in the same form as -since")
+		pick      = fs.Bool("i", false, "pick a PR to review from an interactive list (when on a terminal)")
+		teams     stringsFlag
+		labels    stringsFlag
+	)
+	fs.Var(&teams, "team", "PRs where review is requested from `org/team` (repeatable)")
+	fs.Var(&labels, "label", "only PRs with `label` (repeatable)")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+	}
+
+	var roles []string
+	if *requested {
+		roles = append(roles, "review-requested:"+*user)
+	}
+	if *authored {
+		roles = append(roles, "author:"+*user)
+	}
+	if *mentioned {
+		roles = append(roles, "mentions:"+*user)
+	}
+	for _, team := range teams {
+		roles = append(roles, "team-review-requested:"+team)
+	}
+	if *involves || len(roles) == 0 {
+		roles = append(roles, "involves:"+*user)
+	}
+
+	filters := []string{"type:pull-request"}
+	if *org != "" {
+		filters = append(filters, "org:"+*org)
+	} else {
+		filters = append(filters, fmt.Sprintf("repo:%s/%s", projectOwner, projectRepo))
+	}
+	switch *state {
+	case "open", "closed":
+		filters = append(filters, "state:"+*state)
+	case "merged":
+		filters = append(filters, "is:merged")
+	case "all":
+	default:
+		log.Fatalf("invalid -state %q: must be open, closed, merged or all", *state)
+	}
+	for _, l := range labels {
+		filters = append(filters, fmt.Sprintf("label:%q", l))
+	}
+	switch {
+	case *since != "" && *until != "":
+		filters = append(filters, fmt.Sprintf("updated:%s..%s", searchDate(*since), searchDate(*until)))
+	case *since != "":
+		filters = append(filters, "updated:>="+searchDate(*since))
+	case *until != "":
+		filters = append(filters, "updated:<"+searchDate(*until))
+	}
+
+	queries := make([]string, len(roles))
+	for i, role := range roles {
+		queries[i] = strings.Join(append([]string{role}, filters...), " ")
+	}
+	issues, err := searchPRs(ctx, queries)
+	if err != nil {
+		log.Fatal(err)
+	}
+	summaries := summarizePRs(ctx, issues)
+	if *format != "" {
+		if err := writeFormatted(os.Stdout, summaries, *format); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if !*pick || !isInteractive() {
+		printDashboard(summaries)
+		return
+	}
+	s, err := pickPR(ctx, summaries)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if s == nil {
+		return
+	}
+	projectOwner, projectRepo = s.Owner, s.Repo
+	reviewPR(ctx, s.Number)
+}
+
+// searchDate converts a -since or -until value into a date for a search
+// qualifier. Values are either dates, or ages counted back from now with a
+// unit of h, d, w, mo or y.
+func searchDate(s string) string {
+	if _, err := time.Parse("2006-01-02", s); err == nil {
+		return s
+	}
+	units := []struct {
+		suffix string
+		apply  func(t time.Time, n int) time.Time
+	}{
+		{"mo", func(t time.Time, n int) time.Time { return t.AddDate(0, -n, 0) }},
+		{"h", func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Hour) }},
+		{"d", func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -n) }},
+		{"w", func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -7*n) }},
+		{"y", func(t time.Time, n int) time.Time { return t.AddDate(-n, 0, 0) }},
+	}
+	for _, u := range units {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(s, u.suffix))
+		if err != nil {
+			break
+		}
+		return u.apply(time.Now(), n).Format("2006-01-02")
+	}
+	log.Fatalf("invalid time %q: must be a date like 2006-01-02 or an age like 2w", s)
+	return ""
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+func authUsage() {
+	fmt.Fprintf(os.Stderr, `usage: re auth login [-client-id id] [-scopes scopes] [-store file|keyring]
+       re auth status
+`)
+	os.Exit(2)
+}
+
+func authCmd(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		authUsage()
+	}
+	switch args[0] {
+	case "login":
+		authLogin(ctx, args[1:])
+	case "status":
+		authStatus(ctx)
+	default:
+		authUsage()
+	}
+}
+
+// authLogin obtains a token for projectHost using the OAuth device flow and
+// saves it in a tokenStore.
+func authLogin(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("auth login", flag.ExitOnError)
+	clientID := fs.String("client-id", gitConfig("re.oauthClientId"),
+		"client ID of an OAuth app with device flow enabled (default git config re.oauthClientId)")
+	scopes := fs.String("scopes", "repo read:org", "space-separated OAuth `scopes` to request")
+	store := fs.String("store", "file", "where to save the token: file or keyring")
+	oauthURL := fs.String("oauth-url", "https://"+projectHost, "base `URL` of the OAuth server")
+	fs.Parse(args)
+
+	if *clientID == "" {
+		log.Fatal("no OAuth client ID.\n\n" +
+			"Register an OAuth app at https://" + projectHost + "/settings/applications/new,\n" +
+			"enable device flow for it, and pass its client ID with -client-id or\n" +
+			"save it with git config --global re.oauthClientId <id>.")
+	}
+	s, ok := tokenStores[*store]
+	if !ok {
+		log.Fatalf("unknown token store %q", *store)
+	}
+
+	code, err := requestDeviceCode(ctx, *oauthURL, *clientID, *scopes)
+	if err != nil {
+		log.Fatal(fmt.Errorf("requesting device code: %v", err))
+	}
+	fmt.Printf("First copy your one-time code: %s\n", code.UserCode)
+	fmt.Printf("Then open %s in your browser and paste it.\n", code.VerificationURI)
+
+	tok, err := pollAccessToken(ctx, *oauthURL, *clientID, code)
+	if err != nil {
+		log.Fatal(fmt.Errorf("waiting for authorization: %v", err))
+	}
+	if err := s.save(projectHost, tok); err != nil {
+		log.Fatal(fmt.Errorf("saving token: %v", err))
+	}
+	fmt.Printf("Logged in to %s; token saved to %s.\n", projectHost, s.describe(projectHost))
+}
+
+func authStatus(ctx context.Context) {
+	loadAuth()
+	user, resp, err := client.Users.Get(ctx, "")
+	if err != nil {
+		log.Fatal(fmt.Errorf("getting authenticated user: %v", err))
+	}
+	scopes := resp.Header.Get("X-OAuth-Scopes")
+	if scopes == "" {
+		scopes = "none"
+	}
+	fmt.Println(projectHost)
+	fmt.Printf("  Logged in as %s (token from %s)\n", getUserLogin(user), authSource)
+	fmt.Printf("  Token scopes: %s\n", scopes)
+}
+
+type deviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+type accessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Scope       string `json:"scope"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+	Interval    int    `json:"interval"`
+}
+
+func requestDeviceCode(
+	ctx context.Context, base, clientID, scopes string,
+) (*deviceCode, error) {
+	var code deviceCode
+	err := postOAuthForm(ctx, base+"/login/device/code", url.Values{
+		"client_id": {clientID},
+		"scope":     {scopes},
+	}, &code)
+	if err != nil {
+		return nil, err
+	}
+	if code.DeviceCode == "" {
+		return nil, fmt.Errorf("server returned no device code")
+	}
+	return &code, nil
+}
+
+// pollUnit is the unit of the intervals the OAuth server gives, which tests
+// shorten.
+var pollUnit = time.Second
+
+// pollAccessToken waits for the user to approve code, polling at the interval
+// the server asked for.
+func pollAccessToken(
+	ctx context.Context, base, clientID string, code *deviceCode,
+) (string, error) {
+	interval := time.Duration(code.Interval) * pollUnit
+	if interval == 0 {
+		interval = 5 * pollUnit
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * pollUnit)
+	for code.ExpiresIn == 0 || time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+		var resp accessTokenResponse
+		err := postOAuthForm(ctx, base+"/login/oauth/access_token", url.Values{
+			"client_id":   {clientID},
+			"device_code": {code.DeviceCode},
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		}, &resp)
+		if err != nil {
+			return "", err
+		}
+		switch resp.Error {
+		case "":
+			return resp.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			if resp.Interval != 0 {
+				interval = time.Duration(resp.Interval) * pollUnit
+			} else {
+				interval += 5 * pollUnit
+			}
+		default:
+			return "", fmt.Errorf("%s: %s", resp.Error, resp.Description)
+		}
+	}
+	return "", fmt.Errorf("device code expired")
+}
+
+func postOAuthForm(ctx context.Context, u string, form url.Values, v interface{}) error {
+	req, err := http.NewRequest("POST", u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s: %s", u, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// A tokenStore persists tokens obtained by re auth login.
+type tokenStore interface {
+	save(host, token string) error
+	// describe says where the token for host ends up, for the user's benefit.
+	describe(host string) string
+}
+
+var tokenStores = map[string]tokenStore{
+	"file":    fileStore{},
+	"keyring": keyringStore{},
+}
+
+// fileStore writes tokens to the same files fileToken reads.
+type fileStore struct{}
+
+func (fileStore) save(host, token string) error {
+	filename := tokenFilename(host)
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filename, []byte(token+"\n"), 0600); err != nil {
+		return err
+	}
+	// WriteFile doesn't change the mode of an existing file.
+	return os.Chmod(filename, 0600)
+}
+
+func (fileStore) describe(host string) string {
+	return shortTokenFilename(host)
+}
+
+// keyringStore keeps tokens in the OS keyring, using the security tool on
+// macOS and libsecret's secret-tool elsewhere.
+type keyringStore struct{}
+
+const keyringService = "re"
+
+func (keyringStore) save(host, token string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		// Arguments can be read by anyone with ps, so the command goes to
+		// security's interactive mode on stdin instead.
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -w %q\n",
+			keyringService, host, token))
+	} else {
+		cmd = exec.Command("secret-tool", "store", "--label", "re: "+host,
+			"service", keyringService, "host", host)
+		cmd.Stdin = strings.NewReader(token)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (keyringStore) describe(host string) string {
+	return "the OS keyring"
+}
+
+// keyringToken is the tokenProvider for tokens saved by keyringStore. A
+// missing keyring tool or entry just means there's no token.
+func keyringToken(host string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", host, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "host", host)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", nil
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOAuthServer serves the device flow endpoints, answering successive
+// token requests with responses in turn.
+func fakeOAuthServer(t *testing.T, responses []accessTokenResponse) (*httptest.Server, *int) {
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parsing form: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if got := r.PostForm.Get("client_id"); got != "client" {
+			t.Errorf("client_id = %q, want client", got)
+		}
+		switch r.URL.Path {
+		case "/login/device/code":
+			json.NewEncoder(w).Encode(deviceCode{
+				DeviceCode: "dev", UserCode: "ABCD-1234", VerificationURI: "https://example.com/device",
+				ExpiresIn: 900, Interval: 1,
+			})
+		case "/login/oauth/access_token":
+			if got := r.PostForm.Get("device_code"); got != "dev" {
+				t.Errorf("device_code = %q, want dev", got)
+			}
+			if polls >= len(responses) {
+				t.Errorf("unexpected poll %d", polls+1)
+				http.Error(w, "unexpected poll", http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(responses[polls])
+			polls++
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv, &polls
+}
+
+func TestDeviceFlow(t *testing.T) {
+	defer func(u time.Duration) { pollUnit = u }(pollUnit)
+	pollUnit = time.Millisecond
+
+	for _, tc := range []struct {
+		name      string
+		responses []accessTokenResponse
+		token     string
+		err       string
+	}{
+		{
+			name: "approved",
+			responses: []accessTokenResponse{
+				{Error: "authorization_pending"},
+				{Error: "slow_down", Interval: 2},
+				{Error: "authorization_pending"},
+				{AccessToken: "tok"},
+			},
+			token: "tok",
+		},
+		{
+			name: "expired",
+			responses: []accessTokenResponse{
+				{Error: "authorization_pending"},
+				{Error: "expired_token", Description: "the device code has expired"},
+			},
+			err: "expired_token: the device code has expired",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, polls := fakeOAuthServer(t, tc.responses)
+			defer srv.Close()
+			ctx := context.Background()
+			code, err := requestDeviceCode(ctx, srv.URL, "client", "repo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code.UserCode != "ABCD-1234" {
+				t.Errorf("user code = %q", code.UserCode)
+			}
+			tok, err := pollAccessToken(ctx, srv.URL, "client", code)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("err = %v, want %q", err, tc.err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if tok != tc.token {
+				t.Errorf("token = %q, want %q", tok, tc.token)
+			}
+			if *polls != len(tc.responses) {
+				t.Errorf("polled %d times, want %d", *polls, len(tc.responses))
+			}
+		})
+	}
+}
+
+func TestDeviceFlowCanceled(t *testing.T) {
+	srv, _ := fakeOAuthServer(t, nil)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := pollAccessToken(ctx, srv.URL, "client", &deviceCode{DeviceCode: "dev", Interval: 60})
+	if err != context.Canceled {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+}
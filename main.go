@@ -5,12 +5,14 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -19,30 +21,55 @@ import (
 	"strings"
 	"time"
 
-	"github.com/fatih/color"
 	"github.com/google/go-github/github"
-	"golang.org/x/oauth2"
 )
 
 var (
-	project      = flag.String("p", "", "GitHub owner/repo name (defaults to origin remote of enclosing git repo)")
-	resume       = flag.String("resume", "", "resume review from `file`")
-	tokenFile    = flag.String("token", "", "read GitHub token personal access token from `file` (default $HOME/.github-issue-token)")
-	projectOwner = ""
-	projectRepo  = ""
+	project         = flag.String("p", "", "GitHub [host/]owner/repo name (defaults to origin remote of enclosing git repo)")
+	resume          = flag.String("resume", "", "resume review from `file`")
+	tokenFile       = flag.String("token", "", "read GitHub token personal access token from `file` (default $HOME/.github-issue-token)")
+	contextLines    = flag.Int("context", 0, "show `n` more lines of each file around the diff's hunks")
+	funcContext     = flag.Bool("func", false, "show the line of the function each hunk is in")
+	expandFiles     = flag.Bool("expand", false, "show the whole of each changed file around the diff's hunks")
+	showAnnotations = flag.Bool("annotations", false, "show the annotations of failed checks at the lines they're on")
+	botMode         = flag.String("bots", "", "show comments from bots in `mode`: show, collapse or hide (default git config re.bots.mode, or collapse)")
+	width           = flag.Int("width", 0, "wrap comments at `n` columns (default git config re.width, or 70)")
+	hideViewedFiles = flag.Bool("hide-viewed", false, "leave out files you've marked as viewed since they last changed (default git config re.hideViewed)")
+	mine            = flag.Bool("mine", false, "only show files that CODEOWNERS says you or your teams own")
+	includePaths    stringsFlag
+	excludePaths    stringsFlag
+	split           = flag.Bool("split", false, "review in a directory with a file per changed file, instead of a single file (default git config re.split)")
+	jump            = flag.String("jump", "", "open the editor at `target`: auto, top, toplevel, file or thread (default git config re.jump, or auto)")
+	dryRun          = flag.Bool("dry-run", false, "preview the review instead of submitting it")
+	export          = flag.String("export", "", "also export the finished review to `file`, as JSON if it ends in .json and patch-style otherwise")
+	mergeMethod     = flag.String("method", "", "with m, or merge, merge with `method`: merge, squash or rebase (default git config re.merge.method, or merge)")
+	autoMerge       = flag.Bool("auto", false, "with m, or merge, enable auto-merge instead of merging now")
+	format          = flag.String("format", "", "print list, show and parse output as `json`, or through a Go template like '{{.Number}} {{.Title}}'")
+	projectHost     = defaultHost
+	projectOwner    = ""
+	projectRepo     = ""
 )
 
+const defaultHost = "github.com"
+
 func usage() {
-	fmt.Fprintf(os.Stderr, `usage: re [-p owner/repo] [-resume file] pr-number
+	fmt.Fprintf(os.Stderr, `usage: re [-p [host/]owner/repo] [-resume file] [-split] [-dry-run] [-export file] pr-number
+       re [-p [host/]owner/repo] list [saved-query] [list flags]
+       re [-p [host/]owner/repo] [-format fmt] show pr-number
+       re [-p [host/]owner/repo] merge [-method merge|squash|rebase] [-auto] pr-number
+       re [-format fmt] parse file
+       re [-p [host/]owner/repo] auth login|status
+       re editor install [vim] [nvim] [vscode]
 
 `)
 	flag.PrintDefaults()
 	os.Exit(2)
 }
 
-var sshRe = regexp.MustCompile(`git@github.com:(\w+/\w+)`)
-var httpRe = regexp.MustCompile(`https?:github.com/(\w+/\w+)`)
+var sshRe = regexp.MustCompile(`^(?:ssh://)?git@([^:/]+)[:/]([\w.-]+/[\w.-]+?)(?:\.git)?/?$`)
+var httpRe = regexp.MustCompile(`^https?://(?:[^@/]+@)?([^/]+)/([\w.-]+/[\w.-]+?)(?:\.git)?/?$`)
 
+// inferProject returns the host/owner/repo of the origin remote.
 func inferProject() (string, error) {
 	var outBuf strings.Builder
 	var errBuf strings.Builder
@@ -56,22 +83,24 @@ func inferProject() (string, error) {
 	if errStr != "" {
 		return "", errors.New(errStr)
 	}
-	url := outBuf.String()
+	url := strings.TrimSpace(outBuf.String())
 	var matches []string
 	for _, re := range []*regexp.Regexp{sshRe, httpRe} {
 		matches = re.FindStringSubmatch(url)
-		if len(matches) > 1 {
+		if len(matches) > 2 {
 			break
 		}
 	}
-	if len(matches) == 0 {
+	if len(matches) < 3 {
 		return "", errors.New("found no compatible remote")
 	}
-	return matches[1], nil
+	return matches[1] + "/" + matches[2], nil
 }
 
 func main() {
 	flag.Usage = usage
+	flag.Var(&includePaths, "include", "only show files matching `glob`; may be repeated (default git config re.include)")
+	flag.Var(&excludePaths, "exclude", "leave out files matching `glob`, like '*.pb.go' or 'vendor/**'; may be repeated (default git config re.exclude)")
 	flag.Parse()
 	q := strings.Join(flag.Args(), " ")
 
@@ -87,66 +116,133 @@ func main() {
 	}
 
 	f := strings.Split(*project, "/")
+	if len(f) == 3 {
+		projectHost = f[0]
+		f = f[1:]
+	}
 	if len(f) != 2 {
-		log.Fatal("invalid form for -p argument: must be owner/repo, like golang/go")
+		log.Fatal("invalid form for -p argument: must be [host/]owner/repo, like golang/go")
 	}
 	projectOwner = f[0]
 	projectRepo = f[1]
 
-	loadAuth()
-
 	ctx := context.Background()
 
+	switch flag.Arg(0) {
+	case "auth":
+		authCmd(ctx, flag.Args()[1:])
+		return
+	case "parse":
+		parseCmd(flag.Args()[1:])
+		return
+	case "editor":
+		editorCmd(flag.Args()[1:])
+		return
+	}
+
+	loadAuth()
+	loadUser(ctx)
+
+	switch flag.Arg(0) {
+	case "":
+		listCmd(ctx, nil)
+		return
+	case "list":
+		listCmd(ctx, flag.Args()[1:])
+		return
+	case "show":
+		showCmd(ctx, flag.Args()[1:])
+		return
+	case "merge":
+		mergeCmd(ctx, flag.Args()[1:])
+		return
+	}
+
 	n, _ := strconv.Atoi(q)
-	if n != 0 {
-		var filename string
-		if *resume != "" {
-			filename = *resume
-		} else {
-			filename = makeReviewTemplate(ctx, n)
-		}
+	if n == 0 {
+		usage()
+	}
+	reviewPR(ctx, n)
+}
 
-		request := review(n, filename)
-		postComments(ctx, n, request)
-	} else {
-		user := loadUser()
-		mine, others, err := searchPRs(ctx, user)
+// reviewPR runs the whole review flow for PR n in the current project.
+func reviewPR(ctx context.Context, n int) {
+	var filename string
+	var line int
+	if *resume != "" {
+		filename = *resume
+		draft, _, err := readTemplate(filename)
 		if err != nil {
 			log.Fatal(err)
 		}
-		color.HiWhite("Created by me:")
-		printIssues(mine)
-		fmt.Println()
-		color.HiWhite("Involving me:")
-		printIssues(others)
+		line = jumpLine(nil, draft, jumpTarget())
+	} else {
+		filename, line = makeReviewTemplate(ctx, n)
 	}
-}
 
-func printIssues(issues []*github.Issue) {
-	usernameLength := 10
-	for _, issue := range issues {
-		curLen := len(getUserLogin(issue.User))
-		if curLen > usernameLength {
-			usernameLength = curLen
+	parsed := review(ctx, n, filename, line)
+	if *export != "" {
+		if err := parsed.exportFile(*export); err != nil {
+			log.Fatal(fmt.Errorf("exporting review: %v", err))
 		}
+		fmt.Println("Exported review to", *export)
+	}
+	if *dryRun {
+		parsed.preview(os.Stdout)
+		exitHappy("Dry run; not submitting review.")
+	}
+	// The other changes you confirmed are made even if the review can't be
+	// submitted.
+	reviewErr := postComments(ctx, n, parsed.Request)
+	if reviewErr != nil {
+		log.Printf("error submitting review: %v", reviewErr)
 	}
-	for _, issue := range issues {
-		c := color.GreenString
-		if getString(issue.State) == "closed" {
-			c = color.RedString
+	if len(parsed.Viewed) > 0 {
+		if err := applyViewed(ctx, n, parsed.Viewed); err != nil {
+			log.Fatalf("error updating viewed files: %v", err)
 		}
-		fmt.Printf("%5s  %-"+strconv.Itoa(usernameLength+1)+"s %s\n",
-			c("%d", getInt(issue.Number)), getUserLogin(issue.User), getString(issue.Title))
+	}
+	if err := applyReactions(ctx, n, parsed.Reactions); err != nil {
+		log.Fatalf("error adding reactions: %v", err)
+	}
+	if err := applyEdits(ctx, n, parsed.Edits); err != nil {
+		log.Fatalf("error editing comments: %v", err)
+	}
+	if err := postReplies(ctx, n, parsed.Replies); err != nil {
+		log.Fatalf("error posting replies: %v", err)
+	}
+	if err := applyMetadata(ctx, n, parsed.Metadata); err != nil {
+		log.Fatalf("error updating the PR: %v", err)
+	}
+	if reviewErr != nil {
+		log.Fatal("the review wasn't submitted, though your other changes were made")
+	}
+	if parsed.merge {
+		mergePR(ctx, n, parsed.Request.GetEvent() == reviewApprove)
 	}
 }
 
-func postComments(ctx context.Context, pr int, review *github.PullRequestReviewRequest) {
+// postComments submits review to pr, unless it's empty: without a body,
+// comments or a verdict, which GitHub won't take, as when the template was
+// only used to triage the PR or change your old comments.
+func postComments(ctx context.Context, pr int, review *github.PullRequestReviewRequest) error {
+	event := review.GetEvent()
+	if review.GetBody() == "" && len(review.Comments) == 0 && event != reviewApprove && event != reviewRequestChanges {
+		fmt.Println("No review to submit.")
+		return nil
+	}
 	fmt.Printf("Submitting review... ")
-	_, _, err := client.PullRequests.CreateReview(ctx, projectOwner, projectRepo, pr, review)
-	if err != nil {
-		log.Fatalf("error submitting review: %v", err)
+	if _, _, err := client.PullRequests.CreateReview(ctx, projectOwner, projectRepo, pr, review); err != nil {
+		fmt.Println()
+		return err
 	}
-	fmt.Printf("posted to https://github.com/%s/%s/pull/%d\n", projectOwner, projectRepo, pr)
+	fmt.Printf("posted to %s\n", prURL(pr))
+	return nil
+}
+
+// prURL returns the web URL of pull request n in the current project.
+func prURL(n int) string {
+	return fmt.Sprintf("https://%s/%s/%s/pull/%d", projectHost, projectOwner, projectRepo, n)
 }
 
 func exitHappy(args ...interface{}) {
@@ -186,18 +282,96 @@ func readPipe(cmd *exec.Cmd, buf *bytes.Buffer) error {
 	return nil
 }
 
-func editFile(filename string) ([]byte, error) {
-	if err := runEditor(filename); err != nil {
-		return nil, err
+// editFile has the user edit the template in filename, which may be a split
+// workspace, starting at line, and returns the edited template along with
+// where its lines came from in the workspace.
+func editFile(filename string, line int) ([]byte, []sourceLine, error) {
+	files, line := templateEditorFiles(filename, line)
+	if err := runEditor(files, line); err != nil {
+		return nil, nil, err
 	}
-	updated, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return nil, err
+	return readTemplate(filename)
+}
+
+// editorGoto holds, for editors that can open a file at a given line, the
+// arguments that do so, with {file} and {line} standing for the file and line.
+// They can be set for other editors, or overridden, with git config
+// re.editor.<name>.goto.
+var editorGoto = map[string]string{
+	"vi":            "+{line} {file}",
+	"vim":           "+{line} {file}",
+	"nvim":          "+{line} {file}",
+	"gvim":          "+{line} {file}",
+	"mvim":          "+{line} {file}",
+	"emacs":         "+{line} {file}",
+	"emacsclient":   "+{line} {file}",
+	"nano":          "+{line} {file}",
+	"micro":         "+{line} {file}",
+	"kak":           "+{line} {file}",
+	"joe":           "+{line} {file}",
+	"mg":            "+{line} {file}",
+	"code":          "--goto {file}:{line}",
+	"code-insiders": "--goto {file}:{line}",
+	"codium":        "--goto {file}:{line}",
+	"cursor":        "--goto {file}:{line}",
+	"subl":          "{file}:{line}",
+	"hx":            "{file}:{line}",
+	"zed":           "{file}:{line}",
+	"mate":          "-l {line} {file}",
+	"idea":          "--line {line} {file}",
+	"goland":        "--line {line} {file}",
+}
+
+// editorTakesFiles reports whether the editor ed can open several files at
+// once, which all those in editorGoto can. It can be set for others, or
+// overridden, with git config re.editor.<name>.multiple.
+func editorTakesFiles(ed string) bool {
+	f := strings.Fields(ed)
+	if len(f) == 0 {
+		return false
+	}
+	name := filepath.Base(f[0])
+	switch gitConfig("re.editor." + name + ".multiple") {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	_, ok := editorGoto[name]
+	return ok
+}
+
+// editorArgs returns the arguments that open files in the editor ed, with the
+// first of them at line, if line is non-zero and the editor's syntax for it
+// is known.
+func editorArgs(ed string, files []string, line int) []string {
+	f := strings.Fields(ed)
+	if line <= 0 || len(f) == 0 {
+		return files
+	}
+	name := filepath.Base(f[0])
+	tmpl := gitConfig("re.editor." + name + ".goto")
+	if tmpl == "" {
+		tmpl = editorGoto[name]
+	}
+	if tmpl == "" {
+		return files
+	}
+	if !strings.Contains(tmpl, "{file}") {
+		tmpl += " {file}"
+	}
+	r := strings.NewReplacer("{file}", files[0], "{line}", strconv.Itoa(line))
+	var args []string
+	for _, arg := range strings.Fields(tmpl) {
+		args = append(args, r.Replace(arg))
 	}
-	return updated, nil
+	return append(args, files[1:]...)
 }
 
-func runEditor(filename string) error {
+// runEditor opens files in the user's editor, with the first at line if it's
+// non-zero and the editor supports it. Editors that take a single file, like
+// ed, only get the first.
+func runEditor(files []string, line int) error {
 	ed := os.Getenv("VISUAL")
 	if ed == "" {
 		ed = os.Getenv("EDITOR")
@@ -205,17 +379,22 @@ func runEditor(filename string) error {
 	if ed == "" {
 		ed = "ed"
 	}
+	if len(files) > 1 && !editorTakesFiles(ed) {
+		fmt.Printf("Editing %s; the rest of the review is in %s\n", files[0], filepath.Dir(files[0]))
+		files = files[:1]
+	}
 
 	// If the editor contains spaces or other magic shell chars,
 	// invoke it as a shell command. This lets people have
 	// environment variables like "EDITOR=emacs -nw".
 	// The magic list of characters and the idea of running
 	// sh -c this way is taken from git/run-command.c.
+	args := editorArgs(ed, files, line)
 	var cmd *exec.Cmd
 	if strings.ContainsAny(ed, "|&;<>()$`\\\"' \t\n*?[#~=%") {
-		cmd = exec.Command("sh", "-c", ed+` "$@"`, "$EDITOR", filename)
+		cmd = exec.Command("sh", append([]string{"-c", ed + ` "$@"`, "$EDITOR"}, args...)...)
 	} else {
-		cmd = exec.Command(ed, filename)
+		cmd = exec.Command(ed, args...)
 	}
 
 	cmd.Stdin = os.Stdin
@@ -227,64 +406,44 @@ func runEditor(filename string) error {
 	return nil
 }
 
-func wrap(t string, prefix string) string {
-	out := ""
-	t = strings.Replace(t, "\r\n", "\n", -1)
-	lines := strings.Split(t, "\n")
-	for i, line := range lines {
-		if i > 0 {
-			out += "\n" + prefix
+// currentUser is the login of the authenticated user, set by loadUser.
+var currentUser string
+
+// loadUser returns the login of the user the token belongs to. The answer is
+// cached on disk per host and token, so the API is only asked once. If the
+// API can't be reached and nothing is cached, it falls back to git config
+// github.user.
+func loadUser(ctx context.Context) string {
+	if currentUser != "" {
+		return currentUser
+	}
+	sum := sha256.Sum256([]byte(authToken))
+	key := hex.EncodeToString(sum[:8])
+	cacheFile := filepath.Join(cacheDir(), "user-"+projectHost)
+	if data, err := ioutil.ReadFile(cacheFile); err == nil {
+		f := strings.Fields(string(data))
+		if len(f) == 2 && f[0] == key {
+			currentUser = f[1]
+			return currentUser
 		}
-		s := line
-		for len(s) > 70 {
-			i := strings.LastIndex(s[:70], " ")
-			if i < 0 {
-				i = 69
-			}
-			i++
-			out += strings.TrimRight(s[:i], " ") + "\n" + prefix
-			s = s[i:]
+	}
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		if _, ok := err.(*url.Error); !ok {
+			log.Fatal(fmt.Errorf("getting authenticated user: %v", err))
 		}
-		out += strings.TrimRight(s, " ")
+		log.Printf("unable to reach %s (%v); using git config github.user", projectHost, err)
+		currentUser = loadGitUser()
+		return currentUser
 	}
-	return out
-}
-
-var client *github.Client
-
-// GitHub personal access token, from https://github.com/settings/applications.
-var authToken string
-
-func loadAuth() {
-	const short = ".github-issue-token"
-	filename := filepath.Clean(os.Getenv("HOME") + "/" + short)
-	shortFilename := filepath.Clean("$HOME/" + short)
-	if *tokenFile != "" {
-		filename = *tokenFile
-		shortFilename = *tokenFile
+	currentUser = getUserLogin(user)
+	if err := os.MkdirAll(cacheDir(), 0700); err == nil {
+		ioutil.WriteFile(cacheFile, []byte(key+" "+currentUser+"\n"), 0600)
 	}
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		log.Fatal("reading token: ", err, "\n\n"+
-			"Please create a personal access token at https://github.com/settings/tokens/new\n"+
-			"and write it to ", shortFilename, " to use this program.\n"+
-			"The token only needs the repo scope, or private_repo if you want to\n"+
-			"view or edit issues for private repositories.\n"+
-			"The benefit of using a personal access token over using your GitHub\n"+
-			"password directly is that you can limit its use and revoke it at any time.\n\n")
-	}
-	fi, err := os.Stat(filename)
-	if fi.Mode()&0077 != 0 {
-		log.Fatalf("reading token: %s mode is %#o, want %#o", shortFilename, fi.Mode()&0777, fi.Mode()&0700)
-	}
-	authToken = strings.TrimSpace(string(data))
-	t := &oauth2.Transport{
-		Source: &tokenSource{AccessToken: authToken},
-	}
-	client = github.NewClient(&http.Client{Transport: t})
+	return currentUser
 }
 
-func loadUser() string {
+func loadGitUser() string {
 	cmd := exec.Command("git", "config", "github.user")
 	buf := bytes.NewBuffer(make([]byte, 0, 30))
 	if err := readPipe(cmd, buf); err != nil {
@@ -298,10 +457,22 @@ func loadUser() string {
 	return strings.TrimSpace(buf.String())
 }
 
-type tokenSource oauth2.Token
+// cacheDir is where re keeps state between runs.
+func cacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = filepath.Join(os.Getenv("HOME"), ".cache")
+	}
+	return filepath.Join(dir, "re")
+}
 
-func (t *tokenSource) Token() (*oauth2.Token, error) {
-	return (*oauth2.Token)(t), nil
+// gitConfig returns the value of a git config key, or "" if it's unset.
+func gitConfig(key string) string {
+	out, err := exec.Command("git", "config", "--get", key).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
 }
 
 func getInt(x *int) int {
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultWidth is the width prose in comments is wrapped at, unless -width or
+// git config re.width say otherwise.
+const defaultWidth = 70
+
+var (
+	htmlComment   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlDetails   = regexp.MustCompile(`(?is)<details[^>]*>\s*(?:<summary[^>]*>(.*?)</summary>)?.*?</details>`)
+	htmlImage     = regexp.MustCompile(`(?is)<img\b(?:[^>]*?\balt="([^"]*)")?[^>]*>`)
+	htmlBreak     = regexp.MustCompile(`(?i)<br\s*/?>`)
+	htmlBlock     = regexp.MustCompile(`(?i)</?(?:p|div|table|tr|ul|ol|li|h[1-6]|blockquote|pre)\b[^>]*>`)
+	htmlTag       = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	markdownImage = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	codeFence     = regexp.MustCompile("^\\s*(```+|~~~+)")
+	listItem      = regexp.MustCompile(`^(\s*(?:[-*+]|\d+[.)])\s+)`)
+	quoteLine     = regexp.MustCompile(`^((?:>\s?)+)`)
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+)
+
+// wrapWidth returns the width to wrap comments at, from -width or git config
+// re.width.
+func wrapWidth() int {
+	if *width > 0 {
+		return *width
+	}
+	if n, err := strconv.Atoi(gitConfig("re.width")); err == nil && n > 0 {
+		return n
+	}
+	return defaultWidth
+}
+
+// renderMarkdown lays out a comment written in GitHub's markdown for the
+// terminal, putting prefix before each line after the first. Code blocks and
+// tables are kept as they are, HTML is collapsed to its text, with <details>
+// blocks reduced to their summaries and images to their descriptions, and the
+// rest is wrapped at wrapWidth.
+func renderMarkdown(text string, prefix string) string {
+	width := wrapWidth()
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	// <details> blocks often hold code, so they're collapsed before looking
+	// for it.
+	text = collapseDetails(text)
+	var out []string
+	var prose []string
+	flush := func() {
+		if len(prose) == 0 {
+			return
+		}
+		for _, line := range strings.Split(collapseHTML(strings.Join(prose, "\n")), "\n") {
+			out = append(out, wrapMarkdownLine(line, width)...)
+		}
+		prose = prose[:0]
+	}
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		if fence != "" {
+			out = append(out, line)
+			if m := codeFence.FindStringSubmatch(line); m != nil && strings.HasPrefix(m[1], fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := codeFence.FindStringSubmatch(line); m != nil {
+			flush()
+			fence = m[1]
+			out = append(out, line)
+			continue
+		}
+		if strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(strings.TrimSpace(line), "|") {
+			// Indented code and tables.
+			flush()
+			out = append(out, line)
+			continue
+		}
+		prose = append(prose, line)
+	}
+	flush()
+	for i := range out {
+		out[i] = strings.TrimRight(out[i], " \t")
+	}
+	text = strings.Trim(blankLines.ReplaceAllString(strings.Join(out, "\n"), "\n\n"), "\n")
+	return strings.Replace(text, "\n", "\n"+prefix, -1)
+}
+
+// collapseDetails removes HTML comments, and reduces <details> blocks to
+// their summaries.
+func collapseDetails(s string) string {
+	s = htmlComment.ReplaceAllString(s, "")
+	return htmlDetails.ReplaceAllStringFunc(s, func(d string) string {
+		summary := strings.TrimSpace(htmlTag.ReplaceAllString(htmlDetails.FindStringSubmatch(d)[1], ""))
+		if summary == "" {
+			summary = "Details"
+		}
+		return "\n[" + html.UnescapeString(summary) + " (collapsed)]\n"
+	})
+}
+
+// collapseHTML reduces the HTML in prose to plain text.
+func collapseHTML(s string) string {
+	s = htmlImage.ReplaceAllStringFunc(s, func(img string) string {
+		return imageText(htmlImage.FindStringSubmatch(img)[1])
+	})
+	s = markdownImage.ReplaceAllStringFunc(s, func(img string) string {
+		return imageText(markdownImage.FindStringSubmatch(img)[1])
+	})
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlBlock.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
+
+func imageText(alt string) string {
+	if alt = strings.TrimSpace(alt); alt == "" {
+		return "[image]"
+	}
+	return "[image: " + alt + "]"
+}
+
+// wrapMarkdownLine wraps a line of prose at width, indenting the lines it's
+// continued on to line up under the text of a list item, and repeating the
+// markers of a quote.
+func wrapMarkdownLine(line string, width int) []string {
+	indent := ""
+	if m := quoteLine.FindString(line); m != "" {
+		indent = m
+	} else if m := listItem.FindString(line); m != "" {
+		indent = strings.Repeat(" ", utf8.RuneCountInString(m))
+	}
+	var lines []string
+	for utf8.RuneCountInString(line) > width {
+		i := breakAt(line, width)
+		if i <= len(indent) {
+			// A word too long to break, like a URL.
+			break
+		}
+		lines = append(lines, strings.TrimRight(line[:i], " "))
+		line = indent + strings.TrimLeft(line[i:], " ")
+	}
+	return append(lines, line)
+}
+
+// breakAt returns the byte offset of the last space in the first width runes
+// of line, or failing that, of the first space after them, or -1.
+func breakAt(line string, width int) int {
+	last := -1
+	n := 0
+	for i, r := range line {
+		if n > width && last > 0 {
+			break
+		}
+		if r == ' ' {
+			last = i
+		}
+		n++
+	}
+	return last
+}
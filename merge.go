@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// mergeScissors separates the commit message being edited from the
+// instructions below it, which are ignored, as with git commit
+// --cleanup=scissors. Unlike stripping lines that start with #, it keeps
+// markdown headings in a PR's description.
+const mergeScissors = "# ------------------------ >8 ------------------------"
+
+// Mergeable states GitHub gives for PRs that don't conflict with their base,
+// but that its branch protection won't let be merged: blocked if the PR lacks
+// required reviews or checks, and behind if it has to be up to date with its
+// base first.
+const (
+	mergeableBlocked = "blocked"
+	mergeableBehind  = "behind"
+)
+
+// Merge methods, from -method or git config re.merge.method.
+const (
+	mergeMerge  = "merge"
+	mergeSquash = "squash"
+	mergeRebase = "rebase"
+)
+
+func mergeUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, `usage: re merge [flags] pr-number
+
+Merges a pull request, after checking that it can be merged and that its
+required checks have passed. The commit message, for merge and squash merges,
+is edited in your editor first. With -auto, enables auto-merge instead, so
+that GitHub merges the PR once it's ready.
+
+`)
+		fs.PrintDefaults()
+		os.Exit(2)
+	}
+}
+
+// mergeCmd merges a PR.
+func mergeCmd(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	fs.Usage = mergeUsage(fs)
+	fs.StringVar(mergeMethod, "method", *mergeMethod, "merge with `method`: merge, squash or rebase (default git config re.merge.method, or merge)")
+	fs.BoolVar(autoMerge, "auto", *autoMerge, "enable auto-merge instead of merging now")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+	}
+	n, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		fs.Usage()
+	}
+	mergePR(ctx, n, false)
+}
+
+// mergeMethodConfig returns the merge method to use.
+func mergeMethodConfig() string {
+	method := *mergeMethod
+	if method == "" {
+		method = gitConfig("re.merge.method")
+	}
+	switch method {
+	case "":
+		return mergeMerge
+	case mergeMerge, mergeSquash, mergeRebase:
+		return method
+	}
+	log.Fatalf("invalid merge method %q: must be merge, squash or rebase", method)
+	return ""
+}
+
+// mergePR merges PR n, or with -auto, enables auto-merge for it. approved is
+// set if the user approved it just before.
+func mergePR(ctx context.Context, n int, approved bool) {
+	method := mergeMethodConfig()
+	pr, err := fetchMergeable(ctx, n, approved)
+	if err != nil {
+		log.Fatal(fmt.Errorf("getting pr: %v", err))
+	}
+	// Auto-merge waits for the checks itself.
+	if err := checkMergeable(ctx, pr, !*autoMerge); err != nil {
+		log.Fatal(err)
+	}
+	var title, message string
+	if method != mergeRebase {
+		if title, message, err = editMergeMessage(pr, method); err != nil {
+			log.Fatal(err)
+		}
+		if title == "" {
+			exitHappy("Empty commit message; not merging.")
+		}
+	}
+	if *autoMerge {
+		if err := enableAutoMerge(ctx, pr, method, title, message); err != nil {
+			log.Fatal(fmt.Errorf("enabling auto-merge: %v", err))
+		}
+		fmt.Printf("Enabled auto-merge (%s) for %s\n", method, prURL(n))
+		return
+	}
+	result, _, err := client.PullRequests.Merge(ctx, projectOwner, projectRepo, n, message,
+		&github.PullRequestOptions{
+			CommitTitle: title,
+			SHA:         pr.GetHead().GetSHA(),
+			MergeMethod: method,
+		})
+	if err != nil {
+		log.Fatal(fmt.Errorf("merging: %v", err))
+	}
+	fmt.Printf("Merged %s (%s) as %s\n", prURL(n), method, result.GetSHA())
+}
+
+// fetchMergeable fetches PR n, giving GitHub a few seconds to work out
+// whether it can be merged, which it does in the background after the PR or
+// its base changes, or, if approved is set, after the PR was approved: until
+// then, it can still say the PR is blocked for want of that approval.
+func fetchMergeable(ctx context.Context, n int, approved bool) (*pullRequest, error) {
+	for i := 0; ; i++ {
+		pr, err := getPullRequest(ctx, projectOwner, projectRepo, n)
+		if err != nil {
+			return nil, err
+		}
+		stale := pr.Mergeable == nil || approved && getString(pr.MergeableState) == mergeableBlocked
+		if !stale || pr.GetState() != "open" || i == 5 {
+			return pr, nil
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// checkMergeable returns an error if pr can't be merged: if it's closed, a
+// draft or conflicts with its base, or, if checks is set, if it has to be
+// brought up to date with its base, any of its required checks hasn't passed
+// or it's otherwise blocked by branch protection. Without checks, as for
+// auto-merge, which waits for the checks but won't update the PR, being
+// behind is only warned about. Failed checks that aren't required are warned
+// about too.
+func checkMergeable(ctx context.Context, pr *pullRequest, checks bool) error {
+	n := pr.GetNumber()
+	base := pr.GetBase().GetRef()
+	switch {
+	case pr.GetMerged():
+		return fmt.Errorf("#%d is already merged", n)
+	case pr.GetState() != "open":
+		return fmt.Errorf("#%d is closed", n)
+	case pr.Draft != nil && *pr.Draft:
+		return fmt.Errorf("#%d is a draft; mark it ready for review first", n)
+	case pr.Mergeable == nil:
+		return fmt.Errorf("GitHub hasn't worked out whether #%d can be merged yet; try again shortly", n)
+	case !*pr.Mergeable:
+		return fmt.Errorf("#%d conflicts with %s", n, base)
+	}
+	if getString(pr.MergeableState) == mergeableBehind {
+		if checks {
+			return fmt.Errorf("#%d is behind %s, whose branch protection requires it to be up to date; update it first", n, base)
+		}
+		fmt.Printf("warning: #%d is behind %s, whose branch protection requires it to be up to date; it won't be merged until it's updated\n", n, base)
+	}
+	if !checks {
+		return nil
+	}
+
+	var required []string
+	protection, resp, err := client.Repositories.GetRequiredStatusChecks(ctx, projectOwner, projectRepo, base)
+	switch {
+	case resp != nil && resp.StatusCode == 404:
+		// The base isn't protected, or requires no checks.
+	case err != nil:
+		// Reading branch protection needs admin access, so GitHub will
+		// have to say whether the checks are good enough.
+		log.Printf("can't get required checks: %v", err)
+	default:
+		required = protection.Contexts
+	}
+	c, err := fetchChecks(ctx, projectOwner, projectRepo, pr.GetHead().GetSHA())
+	if err != nil {
+		return fmt.Errorf("getting checks: %v", err)
+	}
+	states := make(map[string]string)
+	for _, s := range c.statuses {
+		state := getString(s.State)
+		if state == "error" {
+			state = ciFailure
+		}
+		states[getString(s.Context)] = worseCIState(states[getString(s.Context)], state)
+	}
+	for _, run := range c.runs {
+		states[run.Name] = worseCIState(states[run.Name], checkRunState(run))
+	}
+
+	isRequired := make(map[string]bool)
+	var problems []string
+	for _, name := range required {
+		isRequired[name] = true
+		switch states[name] {
+		case ciSuccess:
+		case ciFailure:
+			problems = append(problems, fmt.Sprintf("required check %s failed", name))
+		case ciPending:
+			problems = append(problems, fmt.Sprintf("required check %s is pending", name))
+		default:
+			problems = append(problems, fmt.Sprintf("required check %s hasn't run", name))
+		}
+	}
+	if len(problems) == 0 && getString(pr.MergeableState) == mergeableBlocked {
+		problems = append(problems, fmt.Sprintf("%s's branch protection isn't satisfied; it may need more approving reviews", base))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("#%d can't be merged yet:\n\t%s", n, strings.Join(problems, "\n\t"))
+	}
+	for name, state := range states {
+		if state == ciFailure && !isRequired[name] {
+			fmt.Printf("warning: check %s failed, but isn't required\n", name)
+		}
+	}
+	return nil
+}
+
+// defaultMergeMessage returns the title and body GitHub would use for
+// merging pr with method.
+func defaultMergeMessage(pr *pullRequest, method string) (string, string) {
+	if method == mergeSquash {
+		return fmt.Sprintf("%s (#%d)", pr.GetTitle(), pr.GetNumber()), strings.TrimSpace(pr.GetBody())
+	}
+	return fmt.Sprintf("Merge pull request #%d from %s", pr.GetNumber(), pr.GetHead().GetLabel()), pr.GetTitle()
+}
+
+// editMergeMessage has the user edit the commit message for merging pr with
+// method, returning its title, which is empty if the user emptied the
+// message, and its body.
+func editMergeMessage(pr *pullRequest, method string) (string, string, error) {
+	f, err := ioutil.TempFile("", fmt.Sprintf("re-merge-%d-", pr.GetNumber()))
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(f.Name())
+	title, body := defaultMergeMessage(pr, method)
+	what := "merge"
+	if method == mergeSquash {
+		what = "squash merge"
+	}
+	fmt.Fprintf(f, `%s
+
+%s
+
+%s
+# Edit the commit message for the %s of #%d above; its first
+# line is the title. Everything from the line above on is ignored, and an
+# empty message aborts the merge.
+`, title, body, mergeScissors, what, pr.GetNumber())
+	if err := f.Close(); err != nil {
+		return "", "", err
+	}
+	if err := runEditor([]string{f.Name()}, 1); err != nil {
+		return "", "", err
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", "", err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == mergeScissors {
+			break
+		}
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	message := strings.TrimSpace(strings.Join(lines, "\n"))
+	if message == "" {
+		return "", "", nil
+	}
+	parts := strings.SplitN(message, "\n", 2)
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+	return parts[0], strings.TrimSpace(parts[1]), nil
+}
+
+// enableAutoMerge enables auto-merge for pr with method, which can only be
+// done with GraphQL. Rebase merges take no message.
+func enableAutoMerge(ctx context.Context, pr *pullRequest, method, title, message string) error {
+	vars := map[string]interface{}{
+		"id":     getString(pr.NodeID),
+		"method": strings.ToUpper(method),
+	}
+	if method != mergeRebase {
+		vars["headline"] = title
+		vars["body"] = message
+	}
+	const mutation = `mutation($id: ID!, $method: PullRequestMergeMethod!, $headline: String, $body: String) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method, commitHeadline: $headline, commitBody: $body}) { clientMutationId }
+}`
+	return graphQL(ctx, mutation, vars, nil)
+}
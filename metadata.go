@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// The PR's labels, requested reviewers, assignees, milestone and whether it's
+// a draft are shown as fields in the template's header, where they can be
+// edited. Changes to them are found by comparing the template against the
+// original, and made when the review is submitted. Deleting a field's line
+// leaves it as it is; emptying it clears it.
+const (
+	fieldLabels    = "Labels"
+	fieldReviewers = "Reviewers"
+	fieldAssignees = "Assignees"
+	fieldMilestone = "Milestone"
+	fieldDraft     = "Draft"
+)
+
+// metadataField matches an editable field in the template's header.
+var metadataField = regexp.MustCompile(`^(Labels|Reviewers|Assignees|Milestone|Draft):(.*)$`)
+
+// writeMetadata writes the editable fields of pr's header.
+func writeMetadata(w io.Writer, pr *pullRequest) {
+	var labels, reviewers, assignees []string
+	for _, l := range pr.Labels {
+		labels = append(labels, l.GetName())
+	}
+	for _, u := range pr.RequestedReviewers {
+		reviewers = append(reviewers, "@"+u.GetLogin())
+	}
+	for _, t := range pr.RequestedTeams {
+		reviewers = append(reviewers, fmt.Sprintf("@%s/%s", projectOwner, t.GetSlug()))
+	}
+	for _, u := range pr.Assignees {
+		assignees = append(assignees, "@"+u.GetLogin())
+	}
+	writeField := func(name, value string) {
+		fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("%-10s %s", name+":", value), " "))
+	}
+	writeField(fieldLabels, strings.Join(labels, ", "))
+	writeField(fieldReviewers, strings.Join(reviewers, ", "))
+	writeField(fieldAssignees, strings.Join(assignees, ", "))
+	writeField(fieldMilestone, pr.GetMilestone().GetTitle())
+	// Older GitHub Enterprise versions don't know about drafts.
+	if pr.Draft != nil {
+		writeField(fieldDraft, formatDraft(*pr.Draft))
+	}
+}
+
+func formatDraft(draft bool) string {
+	if draft {
+		return "yes"
+	}
+	return "no"
+}
+
+// parseDraft parses the value of the Draft field.
+func parseDraft(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "y", "true":
+		return true, nil
+	case "no", "n", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("Draft must be yes or no, not %q", value)
+}
+
+// splitLabels splits the value of the Labels field. Labels can have spaces
+// in their names, so they're separated by commas alone.
+func splitLabels(value string) []string {
+	var labels []string
+	for _, l := range strings.Split(value, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			labels = append(labels, l)
+		}
+	}
+	return labels
+}
+
+// splitLogins splits the value of the Reviewers or Assignees field into
+// logins, and org/team names, without their leading @.
+func splitLogins(value string) []string {
+	var logins []string
+	for _, l := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+		logins = append(logins, strings.TrimPrefix(l, "@"))
+	}
+	return logins
+}
+
+// metadataChange is the changes to make to the PR's metadata.
+type metadataChange struct {
+	AddLabels       []string `json:"add_labels,omitempty"`
+	RemoveLabels    []string `json:"remove_labels,omitempty"`
+	AddReviewers    []string `json:"add_reviewers,omitempty"`
+	RemoveReviewers []string `json:"remove_reviewers,omitempty"`
+	AddAssignees    []string `json:"add_assignees,omitempty"`
+	RemoveAssignees []string `json:"remove_assignees,omitempty"`
+	// Milestone is the title of the milestone to set, or "" to clear it.
+	Milestone *string `json:"milestone,omitempty"`
+	Draft     *bool   `json:"draft,omitempty"`
+
+	// milestone is the number of Milestone, once resolved.
+	milestone int
+}
+
+// setDifference returns the elements of a that aren't in b, compared case
+// insensitively, as GitHub compares logins and label names.
+func setDifference(a, b []string) []string {
+	in := make(map[string]bool)
+	for _, s := range b {
+		in[strings.ToLower(s)] = true
+	}
+	var diff []string
+	for _, s := range a {
+		if !in[strings.ToLower(s)] {
+			diff = append(diff, s)
+			in[strings.ToLower(s)] = true
+		}
+	}
+	return diff
+}
+
+// metadataChanges returns the changes between orig, the header's fields as
+// the template was generated, and edited, or nil if there are none. Fields
+// missing from either are left alone.
+func metadataChanges(edited, orig map[string]string) (*metadataChange, error) {
+	c := &metadataChange{}
+	for name, value := range edited {
+		was, ok := orig[name]
+		if !ok || value == was {
+			continue
+		}
+		switch name {
+		case fieldLabels:
+			c.AddLabels = setDifference(splitLabels(value), splitLabels(was))
+			c.RemoveLabels = setDifference(splitLabels(was), splitLabels(value))
+		case fieldReviewers:
+			c.AddReviewers = setDifference(splitLogins(value), splitLogins(was))
+			c.RemoveReviewers = setDifference(splitLogins(was), splitLogins(value))
+		case fieldAssignees:
+			c.AddAssignees = setDifference(splitLogins(value), splitLogins(was))
+			c.RemoveAssignees = setDifference(splitLogins(was), splitLogins(value))
+		case fieldMilestone:
+			m := value
+			c.Milestone = &m
+		case fieldDraft:
+			draft, err := parseDraft(value)
+			if err != nil {
+				return nil, err
+			}
+			if wasDraft, _ := parseDraft(was); draft != wasDraft {
+				c.Draft = &draft
+			}
+		}
+	}
+	changed := len(c.AddLabels)+len(c.RemoveLabels)+len(c.AddReviewers)+len(c.RemoveReviewers)+
+		len(c.AddAssignees)+len(c.RemoveAssignees) > 0 || c.Milestone != nil || c.Draft != nil
+	if !changed {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// describe returns a line describing each change, for the preview and
+// summary.
+func (c *metadataChange) describe() []string {
+	if c == nil {
+		return nil
+	}
+	var lines []string
+	list := func(what string, items []string, prefix string) {
+		if len(items) == 0 {
+			return
+		}
+		names := make([]string, len(items))
+		for i, item := range items {
+			names[i] = prefix + item
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", what, strings.Join(names, ", ")))
+	}
+	list("Add labels", c.AddLabels, "")
+	list("Remove labels", c.RemoveLabels, "")
+	list("Request review from", c.AddReviewers, "@")
+	list("Remove review request for", c.RemoveReviewers, "@")
+	list("Assign", c.AddAssignees, "@")
+	list("Unassign", c.RemoveAssignees, "@")
+	if c.Milestone != nil {
+		if *c.Milestone == "" {
+			lines = append(lines, "Clear the milestone")
+		} else {
+			lines = append(lines, fmt.Sprintf("Set the milestone to %s", *c.Milestone))
+		}
+	}
+	if c.Draft != nil {
+		if *c.Draft {
+			lines = append(lines, "Convert the PR to a draft")
+		} else {
+			lines = append(lines, "Mark the PR ready for review")
+		}
+	}
+	return lines
+}
+
+// findMilestone returns the number of the milestone with title.
+func findMilestone(ctx context.Context, title string) (int, error) {
+	opts := &github.MilestoneListOptions{State: "all", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		milestones, resp, err := client.Issues.ListMilestones(ctx, projectOwner, projectRepo, opts)
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range milestones {
+			if strings.EqualFold(m.GetTitle(), title) {
+				return m.GetNumber(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return 0, fmt.Errorf("no milestone %q", title)
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// checkLabels returns an error if any of labels doesn't exist, since adding
+// it would create it.
+func checkLabels(ctx context.Context, labels []string) error {
+	for _, l := range labels {
+		// go-github doesn't escape names, which can hold /, # and the like.
+		_, resp, err := client.Issues.GetLabel(ctx, projectOwner, projectRepo, url.PathEscape(l))
+		if resp != nil && resp.StatusCode == 404 {
+			return fmt.Errorf("no label %q", l)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitTeams splits reviewers into logins and the slugs of teams, which are
+// written as org/team.
+func splitTeams(reviewers []string) github.ReviewersRequest {
+	var r github.ReviewersRequest
+	for _, name := range reviewers {
+		if i := strings.Index(name, "/"); i >= 0 {
+			r.TeamReviewers = append(r.TeamReviewers, name[i+1:])
+		} else {
+			r.Reviewers = append(r.Reviewers, name)
+		}
+	}
+	return r
+}
+
+// resolve checks that the labels to add exist and finds the milestone to set,
+// in the edited template, before anything is changed, so that a typo can be
+// fixed rather than leaving the PR half-updated. It returns a *parseError at
+// the field's line.
+func (c *metadataChange) resolve(ctx context.Context, template []byte) error {
+	if c == nil {
+		return nil
+	}
+	if err := checkLabels(ctx, c.AddLabels); err != nil {
+		return &parseError{line: fieldLine(template, fieldLabels), msg: err.Error()}
+	}
+	if c.Milestone != nil && *c.Milestone != "" {
+		number, err := findMilestone(ctx, *c.Milestone)
+		if err != nil {
+			return &parseError{line: fieldLine(template, fieldMilestone), msg: err.Error()}
+		}
+		c.milestone = number
+	}
+	return nil
+}
+
+// fieldLine returns the line of template with the header field name, or 0
+// if there isn't one.
+func fieldLine(template []byte, name string) int {
+	for i, line := range templateLines(template) {
+		if m := metadataField.FindStringSubmatch(line); m != nil && m[1] == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// applyMetadata makes the changes in c, which has been resolved, to PR n.
+func applyMetadata(ctx context.Context, n int, c *metadataChange) error {
+	if c == nil {
+		return nil
+	}
+	if len(c.AddLabels) > 0 {
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, projectOwner, projectRepo, n, c.AddLabels); err != nil {
+			return fmt.Errorf("adding labels: %v", err)
+		}
+	}
+	for _, l := range c.RemoveLabels {
+		if _, err := client.Issues.RemoveLabelForIssue(ctx, projectOwner, projectRepo, n, url.PathEscape(l)); err != nil {
+			return fmt.Errorf("removing label %q: %v", l, err)
+		}
+	}
+	if len(c.AddReviewers) > 0 {
+		if _, _, err := client.PullRequests.RequestReviewers(ctx, projectOwner, projectRepo, n,
+			splitTeams(c.AddReviewers)); err != nil {
+			return fmt.Errorf("requesting reviews: %v", err)
+		}
+	}
+	if len(c.RemoveReviewers) > 0 {
+		if _, err := client.PullRequests.RemoveReviewers(ctx, projectOwner, projectRepo, n,
+			splitTeams(c.RemoveReviewers)); err != nil {
+			return fmt.Errorf("removing review requests: %v", err)
+		}
+	}
+	if len(c.AddAssignees) > 0 {
+		if _, _, err := client.Issues.AddAssignees(ctx, projectOwner, projectRepo, n, c.AddAssignees); err != nil {
+			return fmt.Errorf("adding assignees: %v", err)
+		}
+	}
+	if len(c.RemoveAssignees) > 0 {
+		if _, _, err := client.Issues.RemoveAssignees(ctx, projectOwner, projectRepo, n, c.RemoveAssignees); err != nil {
+			return fmt.Errorf("removing assignees: %v", err)
+		}
+	}
+	if c.Milestone != nil {
+		// IssueRequest can't clear the milestone, which takes a null.
+		var milestone interface{}
+		if *c.Milestone != "" {
+			milestone = c.milestone
+		}
+		req, err := client.NewRequest("PATCH", fmt.Sprintf("repos/%s/%s/issues/%d", projectOwner, projectRepo, n),
+			map[string]interface{}{"milestone": milestone})
+		if err != nil {
+			return err
+		}
+		if _, err := client.Do(ctx, req, nil); err != nil {
+			return fmt.Errorf("setting the milestone: %v", err)
+		}
+	}
+	if c.Draft != nil {
+		if err := setDraft(ctx, n, *c.Draft); err != nil {
+			return fmt.Errorf("changing draft state: %v", err)
+		}
+	}
+	for _, line := range c.describe() {
+		fmt.Printf("Updated PR %d: %s\n", n, strings.ToLower(line[:1])+line[1:])
+	}
+	return nil
+}
+
+// setDraft converts PR n to a draft, or marks it ready for review, which can
+// only be done with GraphQL.
+func setDraft(ctx context.Context, n int, draft bool) error {
+	pr, err := getPullRequest(ctx, projectOwner, projectRepo, n)
+	if err != nil {
+		return err
+	}
+	mutation := "markPullRequestReadyForReview"
+	if draft {
+		mutation = "convertPullRequestToDraft"
+	}
+	query := fmt.Sprintf(`mutation($id: ID!) {
+  %s(input: {pullRequestId: $id}) { clientMutationId }
+}`, mutation)
+	return graphQL(ctx, query, map[string]interface{}{"id": getString(pr.NodeID)}, nil)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-isatty"
+)
+
+// isInteractive reports whether re is talking to a person at a terminal.
+func isInteractive() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// stty runs stty against the terminal tty.
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalSize returns the number of rows and columns of the terminal.
+func terminalSize() (int, int) {
+	out, err := stty(os.Stdin, "size")
+	if err == nil {
+		f := strings.Fields(out)
+		if len(f) == 2 {
+			rows, err1 := strconv.Atoi(f[0])
+			cols, err2 := strconv.Atoi(f[1])
+			if err1 == nil && err2 == nil && rows > 0 && cols > 0 {
+				return rows, cols
+			}
+		}
+	}
+	return 24, 80
+}
+
+// picker is a full-screen, filterable list of PRs with a preview pane.
+type picker struct {
+	ctx       context.Context
+	all       []*prSummary
+	filter    string
+	shown     []*prSummary
+	selected  int
+	top       int
+	previews  map[*prSummary]string
+	fetching  map[*prSummary]bool
+	previewCh chan previewResult
+}
+
+type previewResult struct {
+	pr   *prSummary
+	text string
+}
+
+// pickPR lets the user choose one of summaries, returning nil if they quit.
+func pickPR(ctx context.Context, summaries []*prSummary) (*prSummary, error) {
+	// Keys are read from a separate handle on the terminal, so that closing
+	// it when we're done stops the reader below from eating input meant for
+	// the review that follows.
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close()
+	saved, err := stty(tty, "-g")
+	if err != nil {
+		return nil, fmt.Errorf("saving terminal state: %v", err)
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("entering raw mode: %v", err)
+	}
+	// Switch to the alternate screen and hide the cursor while picking.
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		stty(tty, saved)
+	}()
+
+	p := &picker{
+		ctx:       ctx,
+		all:       summaries,
+		previews:  make(map[*prSummary]string),
+		fetching:  make(map[*prSummary]bool),
+		previewCh: make(chan previewResult, len(summaries)),
+	}
+	p.applyFilter()
+
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := tty.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- string(buf[:n])
+		}
+	}()
+
+	for {
+		p.draw()
+		select {
+		case res := <-p.previewCh:
+			p.previews[res.pr] = res.text
+			delete(p.fetching, res.pr)
+		case key, ok := <-keys:
+			if !ok {
+				return nil, nil
+			}
+			switch key {
+			case "\x1b", "\x03", "\x04":
+				return nil, nil
+			case "\r", "\n":
+				if len(p.shown) == 0 {
+					continue
+				}
+				return p.shown[p.selected], nil
+			case "\x1b[A", "\x1bOA", "\x10":
+				p.move(-1)
+			case "\x1b[B", "\x1bOB", "\x0e":
+				p.move(1)
+			case "\x1b[5~":
+				p.move(-p.listHeight())
+			case "\x1b[6~":
+				p.move(p.listHeight())
+			case "\x7f", "\x08":
+				if p.filter != "" {
+					_, size := utf8.DecodeLastRuneInString(p.filter)
+					p.filter = p.filter[:len(p.filter)-size]
+					p.applyFilter()
+				}
+			case "\x15":
+				p.filter = ""
+				p.applyFilter()
+			default:
+				if !strings.HasPrefix(key, "\x1b") && key[0] >= ' ' {
+					p.filter += key
+					p.applyFilter()
+				}
+			}
+		}
+	}
+}
+
+func (p *picker) applyFilter() {
+	p.shown = p.shown[:0]
+	for _, s := range p.all {
+		if fuzzyMatch(p.filter, fmt.Sprintf("%d %s %s", s.Number, s.Author, s.Title)) {
+			p.shown = append(p.shown, s)
+		}
+	}
+	p.selected = 0
+	p.top = 0
+}
+
+// fuzzyMatch reports whether the characters of pattern appear in order in s,
+// ignoring case.
+func fuzzyMatch(pattern, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+func (p *picker) move(delta int) {
+	p.selected += delta
+	if p.selected >= len(p.shown) {
+		p.selected = len(p.shown) - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+}
+
+// listHeight is the number of PRs shown at once; the preview pane gets the
+// rest of the screen.
+func (p *picker) listHeight() int {
+	rows, _ := terminalSize()
+	h := (rows - 2) / 2
+	if h < 3 {
+		h = 3
+	}
+	return h
+}
+
+func (p *picker) draw() {
+	rows, cols := terminalSize()
+	height := p.listHeight()
+	if p.selected < p.top {
+		p.top = p.selected
+	} else if p.selected >= p.top+height {
+		p.top = p.selected - height + 1
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	line := func(s string) {
+		b.WriteString(truncate(s, cols))
+		b.WriteString("\r\n")
+	}
+	line(fmt.Sprintf("> %s  (%d/%d; ↑/↓ to move, enter to review, esc to quit)",
+		p.filter, len(p.shown), len(p.all)))
+	for i := p.top; i < p.top+height; i++ {
+		if i >= len(p.shown) {
+			line("")
+			continue
+		}
+		s := p.shown[i]
+		text := fmt.Sprintf("%5d  %-12s %-15s %s", s.Number, s.Author, s.Section, s.Title)
+		if i == p.selected {
+			b.WriteString("\x1b[7m")
+			b.WriteString(truncate(text, cols))
+			b.WriteString("\x1b[0m\r\n")
+		} else {
+			line(text)
+		}
+	}
+	line(strings.Repeat("─", cols))
+	if len(p.shown) > 0 {
+		preview := p.preview(p.shown[p.selected])
+		lines := strings.Split(preview, "\n")
+		for i := 0; i < rows-height-2 && i < len(lines); i++ {
+			if i > 0 {
+				b.WriteString("\r\n")
+			}
+			b.WriteString(truncate(lines[i], cols))
+		}
+	}
+	fmt.Print(b.String())
+}
+
+// preview returns the preview pane text for s, starting a fetch of the parts
+// that need the API if they aren't cached yet.
+func (p *picker) preview(s *prSummary) string {
+	header := fmt.Sprintf("%s/%s#%d: %s\nby %s · %s · %s old · %s\n",
+		s.Owner, s.Repo, s.Number, s.Title, s.Author, s.size(), age(s.CreatedAt), s.mergeable())
+	if text, ok := p.previews[s]; ok {
+		return header + text
+	}
+	if !p.fetching[s] {
+		p.fetching[s] = true
+		go func() {
+			text := "\n" + renderMarkdown(strings.TrimSpace(s.Body), "") + "\n\n"
+			files, err := listFiles(p.ctx, s.Owner, s.Repo, s.Number)
+			if err != nil {
+				text += fmt.Sprintf("error getting files: %v", err)
+			} else {
+				text += formatDiffStat(files)
+			}
+			p.previewCh <- previewResult{pr: s, text: text}
+		}()
+	}
+	return header + "\nloading..."
+}
+
+// truncate cuts s down to at most n columns, expanding tabs.
+func truncate(s string, n int) string {
+	s = strings.Replace(s, "\t", "    ", -1)
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -2,39 +2,531 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/fatih/color"
 	"github.com/google/go-github/github"
 )
 
-func searchPRs(ctx context.Context, user string) ([]*github.Issue, []*github.Issue, error) {
-	var mine []*github.Issue
-	var theirs []*github.Issue
-	q := fmt.Sprintf("type:pull-request state:open repo:%s involves:%s updated:>=%s",
-		*project, user, time.Now().AddDate(0, -1, 0).Format("2006-01-02"))
-	for page := 1; ; {
-		res, resp, err := client.Search.Issues(ctx, q, &github.SearchOptions{
-			Sort: "created",
-			ListOptions: github.ListOptions{
+// searchPRs runs each of the search queries and returns the union of their
+// results.
+func searchPRs(ctx context.Context, queries []string) ([]*github.Issue, error) {
+	var issues []*github.Issue
+	found := make(map[int]bool)
+	for _, q := range queries {
+		for page := 1; ; {
+			res, resp, err := client.Search.Issues(ctx, q, &github.SearchOptions{
+				Sort: "created",
+				ListOptions: github.ListOptions{
+					Page:    page,
+					PerPage: 100,
+				},
+			})
+			if err != nil {
+				return issues, err
+			}
+			for i, issue := range res.Issues {
+				if found[getInt(issue.ID)] {
+					continue
+				}
+				found[getInt(issue.ID)] = true
+				issues = append(issues, &res.Issues[i])
+			}
+			if resp.NextPage < page {
+				break
+			}
+			page = resp.NextPage
+		}
+	}
+	return issues, nil
+}
+
+// pullRequest is a github.PullRequest plus the fields that our go-github
+// doesn't know about yet.
+type pullRequest struct {
+	github.PullRequest
+	NodeID             *string         `json:"node_id,omitempty"`
+	Draft              *bool           `json:"draft,omitempty"`
+	MergeableState     *string         `json:"mergeable_state,omitempty"`
+	RequestedReviewers []*github.User  `json:"requested_reviewers,omitempty"`
+	RequestedTeams     []*github.Team  `json:"requested_teams,omitempty"`
+	Labels             []*github.Label `json:"labels,omitempty"`
+}
+
+func getPullRequest(ctx context.Context, owner, repo string, n int) (*pullRequest, error) {
+	req, err := client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/pulls/%d", owner, repo, n), nil)
+	if err != nil {
+		return nil, err
+	}
+	pr := new(pullRequest)
+	if _, err := client.Do(ctx, req, pr); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// Review states, as reported when listing reviews.
+const (
+	stateApproved         = "APPROVED"
+	stateChangesRequested = "CHANGES_REQUESTED"
+	stateCommented        = "COMMENTED"
+	stateDismissed        = "DISMISSED"
+)
+
+// Dashboard sections, in the order they're printed.
+const (
+	sectionWaitingOnMe        = "Waiting on me"
+	sectionWaitingOnAuthor    = "Waiting on author"
+	sectionWaitingOnReviewers = "Waiting on reviewers"
+	sectionApproved           = "Approved"
+	sectionInvolved           = "Involving me"
+)
+
+var sections = []string{
+	sectionWaitingOnMe,
+	sectionWaitingOnAuthor,
+	sectionWaitingOnReviewers,
+	sectionApproved,
+	sectionInvolved,
+}
+
+// prSummary is what the PR dashboard knows about a pull request.
+type prSummary struct {
+	Owner     string    `json:"owner"`
+	Repo      string    `json:"repo"`
+	Number    int       `json:"number"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Author    string    `json:"author"`
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Additions      int    `json:"additions"`
+	Deletions      int    `json:"deletions"`
+	Mergeable      string `json:"mergeable_state"`
+	CI             string `json:"ci"`
+	ReviewApproved bool   `json:"approved"`
+	ChangesWanted  bool   `json:"changes_requested"`
+
+	// These are from the point of view of the current user.
+	ReviewRequested bool   `json:"review_requested"`
+	MyReview        string `json:"my_review"`
+	NewCommits      bool   `json:"new_commits"`
+	NewComments     int    `json:"new_comments"`
+
+	Section string `json:"section"`
+}
+
+// summarizePRs fetches the details the dashboard needs for each issue.
+func summarizePRs(ctx context.Context, issues []*github.Issue) []*prSummary {
+	seen := loadSeen()
+	// Reviews can be requested from your teams as well as from you.
+	myTeams, err := fetchMyOwnerNames(ctx)
+	if err != nil {
+		log.Printf("can't get your teams: %v", err)
+		myTeams = map[string]bool{"@" + strings.ToLower(currentUser): true}
+	}
+	summaries := make([]*prSummary, len(issues))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for i, issue := range issues {
+		wg.Add(1)
+		go func(i int, issue *github.Issue) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			summaries[i] = summarizePR(ctx, issue, seen, myTeams)
+		}(i, issue)
+	}
+	wg.Wait()
+	return summaries
+}
+
+// summarizePR fetches what the dashboard needs to know about issue, making
+// its API calls concurrently where they don't depend on each other. myTeams
+// holds your login and teams, as fetchMyOwnerNames returns them. What can't be
+// fetched is logged and left unknown, so that one PR doesn't keep the rest
+// from being listed.
+func summarizePR(ctx context.Context, issue *github.Issue, seen map[string]seenPR, myTeams map[string]bool) *prSummary {
+	owner, repo := repoFromURL(getString(issue.RepositoryURL))
+	n := getInt(issue.Number)
+	s := &prSummary{
+		Owner:     owner,
+		Repo:      repo,
+		Number:    n,
+		Title:     getString(issue.Title),
+		Body:      getString(issue.Body),
+		Author:    getUserLogin(issue.User),
+		State:     getString(issue.State),
+		CreatedAt: getTime(issue.CreatedAt),
+	}
+
+	var pr *pullRequest
+	var reviews []*github.PullRequestReview
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var err error
+		if pr, err = getPullRequest(ctx, owner, repo, n); err != nil {
+			log.Printf("can't get pr %d: %v", n, err)
+			pr = nil
+			return
+		}
+		if s.CI, err = ciRollup(ctx, owner, repo, pr.GetHead().GetSHA()); err != nil {
+			log.Printf("can't get ci status for pr %d: %v", n, err)
+			s.CI = ""
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for page := 1; ; {
+			list, resp, err := client.PullRequests.ListReviews(ctx, owner, repo, n, &github.ListOptions{
 				Page:    page,
 				PerPage: 100,
-			},
-		})
-		for i, issue := range res.Issues {
-			if getUserLogin(issue.User) == user {
-				mine = append(mine, &res.Issues[i])
-			} else {
-				theirs = append(theirs, &res.Issues[i])
+			})
+			if err != nil {
+				log.Printf("can't list reviews for pr %d: %v", n, err)
+				reviews = nil
+				return
+			}
+			reviews = append(reviews, list...)
+			if resp.NextPage < page {
+				break
+			}
+			page = resp.NextPage
+		}
+	}()
+	wg.Wait()
+
+	head := ""
+	if pr != nil {
+		head = pr.GetHead().GetSHA()
+		s.Additions = getInt(pr.Additions)
+		s.Deletions = getInt(pr.Deletions)
+		s.Mergeable = getString(pr.MergeableState)
+		for _, u := range pr.RequestedReviewers {
+			if getUserLogin(u) == currentUser {
+				s.ReviewRequested = true
+			}
+		}
+		for _, t := range pr.RequestedTeams {
+			if myTeams[strings.ToLower(fmt.Sprintf("@%s/%s", owner, t.GetSlug()))] {
+				s.ReviewRequested = true
+			}
+		}
+	}
+
+	// Work out each reviewer's verdict, and when the current user last
+	// looked at the PR, either by reviewing it or by opening it in re.
+	verdicts := make(map[string]string)
+	var lastLook time.Time
+	lastLookHead := ""
+	for _, r := range reviews {
+		login := getUserLogin(r.User)
+		state := getString(r.State)
+		if login == currentUser && state != reviewPending {
+			// A comment after an approval or request for changes doesn't
+			// take it back.
+			if state != stateCommented || s.MyReview == "" || s.MyReview == stateCommented {
+				s.MyReview = state
+			}
+			lastLook = getTime(r.SubmittedAt)
+			lastLookHead = getString(r.CommitID)
+		}
+		if login != s.Author && (state == stateApproved || state == stateChangesRequested || state == stateDismissed) {
+			verdicts[login] = state
+		}
+	}
+	for _, state := range verdicts {
+		switch state {
+		case stateApproved:
+			s.ReviewApproved = true
+		case stateChangesRequested:
+			s.ChangesWanted = true
+		}
+	}
+	if look, ok := seen[seenKey(owner, repo, n)]; ok && look.At.After(lastLook) {
+		lastLook = look.At
+		lastLookHead = look.Head
+	}
+
+	if !lastLook.IsZero() {
+		s.NewCommits = pr != nil && lastLookHead != head
+		var err error
+		if s.NewComments, err = countCommentsSince(ctx, owner, repo, n, lastLook); err != nil {
+			log.Printf("can't list comments for pr %d: %v", n, err)
+		}
+	}
+
+	s.Section = s.section()
+	return s
+}
+
+// section decides which part of the dashboard s belongs in.
+func (s *prSummary) section() string {
+	if s.Author == currentUser {
+		switch {
+		case s.ChangesWanted, s.Mergeable == "dirty", s.CI == ciFailure:
+			return sectionWaitingOnMe
+		case s.ReviewApproved:
+			return sectionApproved
+		default:
+			return sectionWaitingOnReviewers
+		}
+	}
+	switch {
+	case s.ReviewRequested:
+		return sectionWaitingOnMe
+	case s.MyReview != "" && s.MyReview != stateApproved && (s.NewCommits || s.NewComments > 0):
+		return sectionWaitingOnMe
+	case s.MyReview == stateApproved:
+		return sectionApproved
+	case s.MyReview != "":
+		return sectionWaitingOnAuthor
+	default:
+		return sectionInvolved
+	}
+}
+
+// countCommentsSince counts the issue and review comments on pr n made by
+// other people after since, fetching the two kinds concurrently.
+func countCommentsSince(ctx context.Context, owner, repo string, n int, since time.Time) (int, error) {
+	var issueCount, reviewCount int
+	var issueErr, reviewErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for page := 1; ; {
+			list, resp, err := client.Issues.ListComments(ctx, owner, repo, n, &github.IssueListCommentsOptions{
+				Since:       since,
+				ListOptions: github.ListOptions{Page: page, PerPage: 100},
+			})
+			if err != nil {
+				issueErr = err
+				return
+			}
+			for _, c := range list {
+				if getUserLogin(c.User) != currentUser && getTime(c.CreatedAt).After(since) {
+					issueCount++
+				}
 			}
+			if resp.NextPage < page {
+				break
+			}
+			page = resp.NextPage
 		}
-		if err != nil {
-			return mine, theirs, err
+	}()
+	go func() {
+		defer wg.Done()
+		for page := 1; ; {
+			list, resp, err := client.PullRequests.ListComments(ctx, owner, repo, n, &github.PullRequestListCommentsOptions{
+				Since:       since,
+				ListOptions: github.ListOptions{Page: page, PerPage: 100},
+			})
+			if err != nil {
+				reviewErr = err
+				return
+			}
+			for _, c := range list {
+				if getUserLogin(c.User) != currentUser && getTime(c.CreatedAt).After(since) {
+					reviewCount++
+				}
+			}
+			if resp.NextPage < page {
+				break
+			}
+			page = resp.NextPage
 		}
-		if resp.NextPage < page {
-			break
+	}()
+	wg.Wait()
+	if issueErr != nil {
+		return 0, issueErr
+	}
+	if reviewErr != nil {
+		return 0, reviewErr
+	}
+	return issueCount + reviewCount, nil
+}
+
+// repoFromURL extracts the owner and repo from an API repository URL like
+// https://api.github.com/repos/owner/repo.
+func repoFromURL(u string) (string, string) {
+	f := strings.Split(strings.TrimSuffix(u, "/"), "/")
+	if len(f) < 2 {
+		return projectOwner, projectRepo
+	}
+	return f[len(f)-2], f[len(f)-1]
+}
+
+func printDashboard(summaries []*prSummary) {
+	usernameLength := 10
+	sizeLength := 0
+	crossRepo := false
+	for _, s := range summaries {
+		if len(s.Author) > usernameLength {
+			usernameLength = len(s.Author)
 		}
-		page = resp.NextPage
+		if l := len(s.size()); l > sizeLength {
+			sizeLength = l
+		}
+		if s.Owner != projectOwner || s.Repo != projectRepo {
+			crossRepo = true
+		}
+	}
+	first := true
+	for _, section := range sections {
+		var in []*prSummary
+		for _, s := range summaries {
+			if s.Section == section {
+				in = append(in, s)
+			}
+		}
+		if len(in) == 0 {
+			continue
+		}
+		if !first {
+			fmt.Println()
+		}
+		first = false
+		color.HiWhite(section + ":")
+		for _, s := range in {
+			c := color.GreenString
+			if s.State == "closed" {
+				c = color.RedString
+			}
+			number := strconv.Itoa(s.Number)
+			if crossRepo {
+				number = s.Owner + "/" + s.Repo + "#" + number
+			}
+			fmt.Printf("%s  %-"+strconv.Itoa(usernameLength+1)+"s %"+strconv.Itoa(sizeLength)+"s %4s  %s  %-9s %-10s %s%s\n",
+				c("%5s", number), s.Author, s.size(), age(s.CreatedAt), s.ciSymbol(),
+				s.mergeable(), s.myState(), s.Title, s.news())
+		}
+	}
+}
+
+func (s *prSummary) size() string {
+	return fmt.Sprintf("+%d/-%d", s.Additions, s.Deletions)
+}
+
+func (s *prSummary) ciSymbol() string {
+	switch s.CI {
+	case ciSuccess:
+		return color.GreenString(ciSymbol(s.CI))
+	case ciFailure:
+		return color.RedString(ciSymbol(s.CI))
+	case ciPending:
+		return color.YellowString(ciSymbol(s.CI))
+	}
+	return ciSymbol(s.CI)
+}
+
+func (s *prSummary) mergeable() string {
+	switch s.Mergeable {
+	case "dirty":
+		return "conflicts"
+	case "clean", "unstable", "has_hooks":
+		return "mergeable"
+	case "unknown", "":
+		return "-"
+	}
+	return s.Mergeable
+}
+
+// myState describes the current user's relationship to the PR.
+func (s *prSummary) myState() string {
+	switch {
+	case s.Author == currentUser:
+		return "author"
+	case s.MyReview == stateApproved:
+		return "approved"
+	case s.MyReview == stateChangesRequested:
+		return "changes"
+	case s.ReviewRequested:
+		return "requested"
+	case s.MyReview != "":
+		return "commented"
+	}
+	return ""
+}
+
+func (s *prSummary) news() string {
+	var news []string
+	if s.NewCommits {
+		news = append(news, "new commits")
+	}
+	if s.NewComments == 1 {
+		news = append(news, "1 new comment")
+	} else if s.NewComments > 1 {
+		news = append(news, fmt.Sprintf("%d new comments", s.NewComments))
+	}
+	if len(news) == 0 {
+		return ""
+	}
+	return color.CyanString(" (%s)", strings.Join(news, ", "))
+}
+
+// age formats the time since t compactly, like 5m, 3h or 2d.
+func age(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d < 14*24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	return fmt.Sprintf("%dw", int(d.Hours()/24/7))
+}
+
+// seenPR records when the current user last opened a PR in re, and what its
+// head commit was at the time.
+type seenPR struct {
+	At   time.Time
+	Head string
+}
+
+func seenFile() string {
+	return filepath.Join(cacheDir(), "seen-"+projectHost+".json")
+}
+
+func seenKey(owner, repo string, n int) string {
+	return fmt.Sprintf("%s/%s#%d", owner, repo, n)
+}
+
+func loadSeen() map[string]seenPR {
+	seen := make(map[string]seenPR)
+	data, err := ioutil.ReadFile(seenFile())
+	if err != nil {
+		return seen
+	}
+	json.Unmarshal(data, &seen)
+	return seen
+}
+
+// markSeen notes that the current user is looking at PR n at head. Failing
+// to save this only makes the dashboard less helpful, so errors are ignored.
+func markSeen(owner, repo string, n int, head string) {
+	seen := loadSeen()
+	seen[seenKey(owner, repo, n)] = seenPR{At: time.Now(), Head: head}
+	data, err := json.Marshal(seen)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(cacheDir(), 0700); err != nil {
+		return
 	}
-	return mine, theirs, nil
+	ioutil.WriteFile(seenFile(), data, 0600)
 }
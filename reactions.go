@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// A reaction is added to an existing comment by typing a line like
+//
+//	/react +1
+//
+// under it: in an inline comment block, under the comment, and in the PR's
+// conversation at the top of the template, under a comment, or under the PR's
+// description to react to the PR itself. Reviews can't be reacted to.
+
+// Our go-github can list reactions but not create them.
+const mediaTypeReactionsPreview = "application/vnd.github.squirrel-girl-preview"
+
+var (
+	reactionLine = regexp.MustCompile(`^/react (\S+)$`)
+	// replyId matches the header of a reply in an inline comment block.
+	replyId = regexp.MustCompile(`^\* Comment by (?:@\S+|you) \([^\)]+\) id (\d+)$`)
+	// issueCommentId matches the header of a comment in the PR's
+	// conversation.
+	issueCommentId = regexp.MustCompile(`^Comment by \S+ \([^\)]+\) id (\d+)$`)
+	// conversationHeader matches the header of the PR's description or of
+	// any comment in its conversation, capturing its author.
+	conversationHeader = regexp.MustCompile(`^(?:Created|Comment|Approved|Changes requested|Draft comment) by (\S+) \(`)
+)
+
+// prCreatedBy starts the header of the PR's description.
+const prCreatedBy = "Created by "
+
+// reactionContents are the reactions GitHub knows.
+var reactionContents = []string{"+1", "-1", "laugh", "confused", "heart", "hooray", "rocket", "eyes"}
+
+// Kinds of things that can be reacted to, or edited.
+const (
+	targetPR            = "pr"
+	targetIssueComment  = "issue_comment"
+	targetReviewComment = "review_comment"
+	// Reviews can be edited, but not reacted to.
+	targetReview = "review"
+)
+
+// parsedReaction is a reaction to add, to the PR or to the comment with ID.
+type parsedReaction struct {
+	Kind    string `json:"kind"`
+	ID      int    `json:"id,omitempty"`
+	Content string `json:"content"`
+}
+
+// checkReaction returns an error if content isn't a reaction GitHub knows.
+func checkReaction(content string) error {
+	for _, c := range reactionContents {
+		if content == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown reaction %q: must be one of %s", content, strings.Join(reactionContents, ", "))
+}
+
+// reactions are the counts of each reaction to a comment or the PR. Our
+// go-github's Reactions predates rocket and eyes.
+type reactions struct {
+	TotalCount int `json:"total_count,omitempty"`
+	PlusOne    int `json:"+1,omitempty"`
+	MinusOne   int `json:"-1,omitempty"`
+	Laugh      int `json:"laugh,omitempty"`
+	Confused   int `json:"confused,omitempty"`
+	Heart      int `json:"heart,omitempty"`
+	Hooray     int `json:"hooray,omitempty"`
+	Rocket     int `json:"rocket,omitempty"`
+	Eyes       int `json:"eyes,omitempty"`
+}
+
+// issueComment is a comment in the PR's conversation, with all its reactions.
+type issueComment struct {
+	github.IssueComment
+	Reactions *reactions `json:"reactions,omitempty"`
+}
+
+// inlineComment is an inline comment, with all its reactions.
+type inlineComment struct {
+	github.PullRequestComment
+	Reactions *reactions `json:"reactions,omitempty"`
+}
+
+// listWithReactions fetches the page of the list at u into v, which is a
+// slice of one of the types above, with the reactions of what's listed.
+func listWithReactions(ctx context.Context, u string, page int, v interface{}) (*github.Response, error) {
+	req, err := client.NewRequest("GET", fmt.Sprintf("%s?per_page=100&page=%d", u, page), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeReactionsPreview)
+	return client.Do(ctx, req, v)
+}
+
+// fetchPRReactions fetches the reactions to PR n itself, which GitHub gives
+// with the PR's issue rather than the PR.
+func fetchPRReactions(ctx context.Context, n int) (*reactions, error) {
+	req, err := client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/issues/%d", projectOwner, projectRepo, n), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", mediaTypeReactionsPreview)
+	var issue struct {
+		Reactions *reactions `json:"reactions"`
+	}
+	if _, err := client.Do(ctx, req, &issue); err != nil {
+		return nil, err
+	}
+	return issue.Reactions, nil
+}
+
+// formatReactions formats reaction counts, like "+1 ×2, heart ×1", or returns
+// "" if there are none.
+func formatReactions(r *reactions) string {
+	if r == nil {
+		return ""
+	}
+	var counts []string
+	for _, c := range []struct {
+		name  string
+		count int
+	}{
+		{"+1", r.PlusOne}, {"-1", r.MinusOne}, {"laugh", r.Laugh},
+		{"confused", r.Confused}, {"heart", r.Heart}, {"hooray", r.Hooray},
+		{"rocket", r.Rocket}, {"eyes", r.Eyes},
+	} {
+		if c.count > 0 {
+			counts = append(counts, fmt.Sprintf("%s ×%d", c.name, c.count))
+		}
+	}
+	if len(counts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(counts, ", ") + "]"
+}
+
+// describe describes the reaction, for the preview.
+func (r *parsedReaction) describe() string {
+	switch r.Kind {
+	case targetPR:
+		return fmt.Sprintf("React %s to the PR", r.Content)
+	case targetIssueComment:
+		return fmt.Sprintf("React %s to comment %d", r.Content, r.ID)
+	}
+	return fmt.Sprintf("React %s to inline comment %d", r.Content, r.ID)
+}
+
+// applyReactions adds reactions to PR n and its comments.
+func applyReactions(ctx context.Context, n int, reactions []*parsedReaction) error {
+	for _, r := range reactions {
+		var u string
+		switch r.Kind {
+		case targetPR:
+			u = fmt.Sprintf("repos/%s/%s/issues/%d/reactions", projectOwner, projectRepo, n)
+		case targetIssueComment:
+			u = fmt.Sprintf("repos/%s/%s/issues/comments/%d/reactions", projectOwner, projectRepo, r.ID)
+		case targetReviewComment:
+			u = fmt.Sprintf("repos/%s/%s/pulls/comments/%d/reactions", projectOwner, projectRepo, r.ID)
+		}
+		req, err := client.NewRequest("POST", u, map[string]string{"content": r.Content})
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", mediaTypeReactionsPreview)
+		if _, err := client.Do(ctx, req, nil); err != nil {
+			return fmt.Errorf("adding reaction %s: %v", r.Content, err)
+		}
+		fmt.Println(strings.Replace(r.describe(), "React", "Reacted", 1))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// A reply to the PR's description or to a comment in its conversation is
+// typed on new lines under it, without a leading tab, which marks the text of
+// the original. It's posted as a comment of its own, quoting the original as
+// it's shown in the template.
+
+// reactionCounts matches the line of reaction counts under a comment.
+var reactionCounts = regexp.MustCompile(`^\[(?:[+\-\w]+ ×\d+(?:, )?)+\]$`)
+
+// parsedReply is a reply to a comment, or the description, by To.
+type parsedReply struct {
+	To    string `json:"to"`
+	Quote string `json:"quote"`
+	Body  string `json:"body"`
+}
+
+// replyTarget accumulates the reply to a comment while parsing.
+type replyTarget struct {
+	to    string
+	quote []string
+	body  []string
+}
+
+// newReplyTarget starts a reply to the comment or description with the given
+// header, or returns nil if header isn't one.
+func newReplyTarget(header string) *replyTarget {
+	m := conversationHeader.FindStringSubmatch(header)
+	if m == nil {
+		return nil
+	}
+	to := m[1]
+	if to == "you" {
+		to = currentUser
+	}
+	return &replyTarget{to: to}
+}
+
+// addLine adds a line under the comment: part of its text if it starts with
+// a tab, and of the reply otherwise.
+func (t *replyTarget) addLine(line string) {
+	if strings.HasPrefix(line, "\t") {
+		if text := line[1:]; !reactionCounts.MatchString(text) {
+			t.quote = append(t.quote, text)
+		}
+		return
+	}
+	if len(t.body) > 0 || strings.TrimSpace(line) != "" {
+		t.body = append(t.body, line)
+	}
+}
+
+// reply returns the reply typed under the comment, or nil if there's none.
+func (t *replyTarget) reply() *parsedReply {
+	body := strings.TrimSpace(strings.Join(t.body, "\n"))
+	if body == "" {
+		return nil
+	}
+	return &parsedReply{
+		To:    t.to,
+		Quote: strings.TrimSpace(strings.Join(t.quote, "\n")),
+		Body:  body,
+	}
+}
+
+// text returns the comment to post for the reply.
+func (r *parsedReply) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@%s wrote:\n", r.To)
+	for _, line := range strings.Split(r.Quote, "\n") {
+		if line == "" {
+			b.WriteString(">\n")
+		} else {
+			fmt.Fprintf(&b, "> %s\n", line)
+		}
+	}
+	fmt.Fprintf(&b, "\n%s", r.Body)
+	return b.String()
+}
+
+// postReplies posts replies as comments on PR n.
+func postReplies(ctx context.Context, n int, replies []*parsedReply) error {
+	for _, r := range replies {
+		body := r.text()
+		if _, _, err := client.Issues.CreateComment(ctx, projectOwner, projectRepo, n,
+			&github.IssueComment{Body: &body}); err != nil {
+			return fmt.Errorf("replying to @%s: %v", r.To, err)
+		}
+		fmt.Printf("Replied to @%s\n", r.To)
+	}
+	return nil
+}
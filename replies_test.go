@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// TestReplyStartingWithHash checks that a reply whose first line starts with
+// #, like an issue reference, is posted rather than taken for the template's
+// instructions.
+func TestReplyStartingWithHash(t *testing.T) {
+	defer func(user, owner, repo string, b *botFilter) {
+		currentUser, projectOwner, projectRepo, bots = user, owner, repo, b
+	}(currentUser, projectOwner, projectRepo, bots)
+	currentUser, projectOwner, projectRepo = "me", "o", "r"
+	bots = &botFilter{mode: botsCollapse}
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	pr := &pullRequest{}
+	pr.Number = github.Int(7)
+	pr.Title = github.String("Do the thing")
+	pr.State = github.String("open")
+	pr.Body = github.String("This does the thing.")
+	pr.User = &github.User{Login: github.String("alice")}
+	pr.CreatedAt = &now
+	d := &prData{
+		number: 7,
+		pr:     pr,
+		issueComments: []*issueComment{{IssueComment: github.IssueComment{
+			ID: github.Int(200), User: &github.User{Login: github.String("bob")},
+			Body: github.String("Isn't this done already?"), CreatedAt: &now,
+		}}},
+	}
+	orig := renderTemplate(context.Background(), d)
+
+	const header = "\tIsn't this done already?\n"
+	if !strings.Contains(string(orig), header) {
+		t.Fatalf("template has no comment from bob:\n%s", orig)
+	}
+	edited := []byte(strings.Replace(string(orig), header, header+"\n#1234 is a dup of this\n# and so is #1235\n", 1))
+	if err := validateTemplate(orig, edited); err != nil {
+		t.Fatalf("validateTemplate: %v", err)
+	}
+	parsed, err := parseEdited(edited, orig)
+	if err != nil {
+		t.Fatalf("parseEdited: %v", err)
+	}
+	if len(parsed.Replies) != 1 {
+		t.Fatalf("got %d replies, want 1", len(parsed.Replies))
+	}
+	r := parsed.Replies[0]
+	if want := "#1234 is a dup of this\n# and so is #1235"; r.To != "bob" || r.Body != want {
+		t.Errorf("got reply to %s with body %q, want reply to bob with body %q", r.To, r.Body, want)
+	}
+}
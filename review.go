@@ -4,12 +4,14 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -24,9 +26,9 @@ import (
 
 type commitComments map[string]fileComments
 type fileComments map[string]lineComments
-type lineComments map[int][]*github.PullRequestComment
+type lineComments map[int][]*inlineComment
 
-func (c commitComments) get(commit string, file string, line int) []*github.PullRequestComment {
+func (c commitComments) get(commit string, file string, line int) []*inlineComment {
 	if files, ok := c[commit]; ok {
 		if lines, ok := files[file]; ok {
 			if comments, ok := lines[line]; ok {
@@ -37,7 +39,7 @@ func (c commitComments) get(commit string, file string, line int) []*github.Pull
 	return nil
 }
 
-func (c commitComments) put(comment *github.PullRequestComment) {
+func (c commitComments) put(comment *inlineComment) {
 	commit := *comment.CommitID
 	file := *comment.Path
 	if comment.Position == nil {
@@ -56,63 +58,118 @@ func (c commitComments) put(comment *github.PullRequestComment) {
 
 // topLevelComment represents either a review comment or an issue comment.
 type topLevelComment struct {
+	id        int
+	kind      string
 	body      string
 	author    string
 	createdAt time.Time
+	// bot is whether the comment is from a bot.
+	bot bool
+	// editable is whether the comment is yours and can be edited as it
+	// was written.
+	editable  bool
+	reactions *reactions
 	// Only for reviews
 	state    string
 	commitID string
 }
 
+// Kinds of topLevelComment.
+const (
+	kindReview       = "review"
+	kindIssueComment = "comment"
+)
+
+func (c topLevelComment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID        int       `json:"id"`
+		Kind      string    `json:"kind"`
+		Author    string    `json:"author"`
+		CreatedAt time.Time `json:"created_at"`
+		Body      string    `json:"body"`
+		Bot       bool      `json:"bot,omitempty"`
+		State     string    `json:"state,omitempty"`
+		CommitID  string    `json:"commit_id,omitempty"`
+	}{c.id, c.kind, c.author, c.createdAt, c.body, c.bot, c.state, c.commitID})
+}
+
 type topLevelComments []topLevelComment
 
 func (c topLevelComments) Len() int           { return len(c) }
 func (c topLevelComments) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
 func (c topLevelComments) Less(i, j int) bool { return c[i].createdAt.Before(c[j].createdAt) }
 
-func makeReviewTemplate(ctx context.Context, n int) string {
+// prData is everything re fetches about a PR in order to review it.
+type prData struct {
+	number         int
+	pr             *pullRequest
+	files          []*github.CommitFile
+	diff           string
+	reviews        []*github.PullRequestReview
+	issueComments  []*issueComment
+	reviewComments []*inlineComment
+	// reactions are the reactions to the PR itself, if they could be
+	// fetched.
+	reactions *reactions
+	// viewed is whether you've viewed each file since it last changed, or
+	// nil if that isn't known.
+	viewed map[string]bool
+	// owners is the CODEOWNERS file at the PR's base, if it has one.
+	owners codeOwners
+	// myOwnerNames are the names you own code by, fetched for -mine.
+	myOwnerNames map[string]bool
+	// checks is the CI state of the PR's head, if it could be fetched.
+	checks *prChecks
+}
+
+// fetchPR fetches PR n of the current project, making its API calls
+// concurrently.
+func fetchPR(ctx context.Context, n int) *prData {
 	log.Printf("Fetching details for PR %d", n)
+	d := &prData{number: n}
 	var wg sync.WaitGroup
-	wg.Add(6)
-	var pr *github.PullRequest
+	wg.Add(10)
 	go func() {
 		start := time.Now()
 		var err error
-		pr, _, err = client.PullRequests.Get(ctx, projectOwner, projectRepo, n)
+		d.pr, err = getPullRequest(ctx, projectOwner, projectRepo, n)
 		if err != nil {
 			log.Fatal(fmt.Errorf("getting pr: %v", err))
 		}
+		go func() {
+			owners, err := fetchCodeOwners(ctx, d.pr.GetBase().GetSHA())
+			if err != nil {
+				log.Printf("can't get CODEOWNERS: %v", err)
+			} else {
+				d.owners = owners
+			}
+			wg.Done()
+		}()
+		go func() {
+			checks, err := fetchChecks(ctx, projectOwner, projectRepo, d.pr.GetHead().GetSHA())
+			if err != nil {
+				log.Printf("can't get checks: %v", err)
+			} else {
+				d.checks = checks
+			}
+			wg.Done()
+		}()
 		wg.Done()
 
 		log.Printf("Fetched pr in %v", time.Now().Sub(start))
 	}()
 
-	var diffStat strings.Builder
-	writer := tabwriter.NewWriter(&diffStat, 10, 4, 4, ' ', 0)
 	go func() {
-		opt := &github.ListOptions{PerPage: 200}
-		for {
-			files, resp, err := client.PullRequests.ListFiles(ctx, projectOwner, projectRepo, n, opt)
-			if err != nil {
-				log.Fatal(fmt.Errorf("getting pr files: %v", err))
-			}
-			for _, file := range files {
-				fmt.Fprintf(writer, "%s\t\t+%d\t-%d\n", file.GetFilename(), file.GetAdditions(), file.GetDeletions())
-			}
-
-			opt.Page = resp.NextPage
-			if opt.Page == 0 {
-				break
-			}
-		}
-		if err := writer.Flush(); err != nil {
-			panic(err)
+		var err error
+		d.files, err = listFiles(ctx, projectOwner, projectRepo, n)
+		if err != nil {
+			log.Fatal(fmt.Errorf("getting pr files: %v", err))
 		}
 		wg.Done()
 	}()
 
-	diffBuf := bytes.NewBuffer(make([]byte, 0, 1024))
 	go func() {
+		diffBuf := bytes.NewBuffer(make([]byte, 0, 1024))
 		commits, _, err := client.PullRequests.ListCommits(ctx, projectOwner, projectRepo, n, &github.ListOptions{})
 		if err != nil {
 			log.Fatal(fmt.Errorf("getting pr commits: %v", err))
@@ -120,7 +177,7 @@ func makeReviewTemplate(ctx context.Context, n int) string {
 		for _, ghCommit := range commits {
 			raw, _, err := client.Repositories.GetCommitRaw(ctx, projectOwner, projectRepo, ghCommit.GetSHA(),
 				github.RawOptions{Type: github.Diff},
-				)
+			)
 			if err != nil {
 				log.Fatal(fmt.Errorf("getting pr commits: %v", err))
 			}
@@ -145,9 +202,9 @@ Date:	%s
 			diffBuf.WriteByte('\n')
 			diffBuf.WriteString(raw)
 		}
+		d.diff = diffBuf.String()
 		wg.Done()
 	}()
-	reviews := make([]*github.PullRequestReview, 0, 10)
 	go func() {
 		start := time.Now()
 		for page := 1; ; {
@@ -158,7 +215,7 @@ Date:	%s
 			if err != nil {
 				log.Fatal(fmt.Errorf("invoking list reviews: %v", err))
 			}
-			reviews = append(reviews, list...)
+			d.reviews = append(d.reviews, list...)
 			if resp.NextPage < page {
 				break
 			}
@@ -167,20 +224,15 @@ Date:	%s
 		wg.Done()
 		log.Printf("Fetched reviews in %v", time.Now().Sub(start))
 	}()
-	issueComments := make([]*github.IssueComment, 0, 10)
 	go func() {
 		start := time.Now()
 		for page := 1; ; {
-			list, resp, err := client.Issues.ListComments(ctx, projectOwner, projectRepo, n, &github.IssueListCommentsOptions{
-				ListOptions: github.ListOptions{
-					Page:    page,
-					PerPage: 100,
-				},
-			})
+			var list []*issueComment
+			resp, err := listWithReactions(ctx, fmt.Sprintf("repos/%s/%s/issues/%d/comments", projectOwner, projectRepo, n), page, &list)
 			if err != nil {
 				log.Fatal(fmt.Errorf("invoking list issue comments: %v", err))
 			}
-			issueComments = append(issueComments, list...)
+			d.issueComments = append(d.issueComments, list...)
 			if resp.NextPage < page {
 				break
 			}
@@ -189,22 +241,15 @@ Date:	%s
 		log.Printf("Fetched issue comments in %v", time.Now().Sub(start))
 		wg.Done()
 	}()
-	reviewComments := make(commitComments)
 	go func() {
 		start := time.Now()
 		for page := 1; ; {
-			list, resp, err := client.PullRequests.ListComments(ctx, projectOwner, projectRepo, n, &github.PullRequestListCommentsOptions{
-				ListOptions: github.ListOptions{
-					Page:    page,
-					PerPage: 100,
-				},
-			})
+			var list []*inlineComment
+			resp, err := listWithReactions(ctx, fmt.Sprintf("repos/%s/%s/pulls/%d/comments", projectOwner, projectRepo, n), page, &list)
 			if err != nil {
 				log.Fatal(fmt.Errorf("invoking list issue comments: %v", err))
 			}
-			for _, comment := range list {
-				reviewComments.put(comment)
-			}
+			d.reviewComments = append(d.reviewComments, list...)
 			if resp.NextPage < page {
 				break
 			}
@@ -213,37 +258,238 @@ Date:	%s
 		log.Printf("Fetched review comments in %v", time.Now().Sub(start))
 		wg.Done()
 	}()
+	go func() {
+		reactions, err := fetchPRReactions(ctx, n)
+		if err != nil {
+			log.Printf("can't get the PR's reactions: %v", err)
+		} else {
+			d.reactions = reactions
+		}
+		wg.Done()
+	}()
+	go func() {
+		// Viewed files are a nicety, and GitHub Enterprise may not have them.
+		_, viewed, err := prViewedState(ctx, n)
+		if err != nil {
+			log.Printf("can't get viewed files: %v", err)
+		} else {
+			d.viewed = viewed
+		}
+		wg.Done()
+	}()
+	if *mine {
+		wg.Add(1)
+		go func() {
+			var err error
+			d.myOwnerNames, err = fetchMyOwnerNames(ctx)
+			if err != nil {
+				log.Fatal(fmt.Errorf("getting your teams: %v", err))
+			}
+			wg.Done()
+		}()
+	}
 	wg.Wait()
+	if *mine && d.owners == nil {
+		log.Fatal("-mine needs a CODEOWNERS file, and the PR's base has none")
+	}
+	return d
+}
+
+// omitReason returns why path is left out of the template, or "" if it
+// isn't.
+func (d *prData) omitReason(path string) string {
+	if hideViewed() && d.viewed[path] {
+		return "viewed"
+	}
+	if *mine && !d.ownedByMe(path) {
+		return "not yours"
+	}
+	return pathFilters().omitReason(path)
+}
+
+// omitFile reports whether path should be left out of the template.
+func (d *prData) omitFile(path string) bool {
+	return d.omitReason(path) != ""
+}
+
+// shownDiff returns the PR's diff without the files left out of the
+// template.
+func (d *prData) shownDiff() string {
+	var b strings.Builder
+	omitting := false
+	for _, line := range strings.SplitAfter(d.diff, "\n") {
+		trimmed := strings.TrimRight(line, "\n")
+		if m := diffFilePath.FindStringSubmatch(trimmed); m != nil {
+			omitting = d.omitFile(m[1])
+		} else if commitStart.MatchString(trimmed) {
+			omitting = false
+		}
+		// Keep the blank line between one commit's diff and the next
+		// commit's header.
+		if !omitting || trimmed == "" {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+// diffStat formats the diffstat of the files in the template, followed by a
+// summary of those left out, for each reason they were.
+func (d *prData) diffStat() string {
+	var shown []*github.CommitFile
+	var reasons []string
+	omitted := make(map[string][]*github.CommitFile)
+	for _, f := range d.files {
+		reason := d.omitReason(f.GetFilename())
+		if reason == "" {
+			shown = append(shown, f)
+			continue
+		}
+		if omitted[reason] == nil {
+			reasons = append(reasons, reason)
+		}
+		omitted[reason] = append(omitted[reason], f)
+	}
+	diffStat := formatDiffStat(shown)
+	for _, reason := range reasons {
+		files := omitted[reason]
+		additions, deletions := 0, 0
+		for _, f := range files {
+			additions += f.GetAdditions()
+			deletions += f.GetDeletions()
+		}
+		noun := "files"
+		if len(files) == 1 {
+			noun = "file"
+		}
+		diffStat += fmt.Sprintf("(%d %s not shown, %s: +%d -%d)\n", len(files), noun, reason, additions, deletions)
+	}
+	return diffStat
+}
 
-	topLevelComments := make(topLevelComments, 0, len(reviews)+len(issueComments))
-	for _, r := range reviews {
+// topLevelComments merges the PR's reviews and issue comments into a single
+// conversation, oldest first.
+func (d *prData) topLevelComments() topLevelComments {
+	topLevelComments := make(topLevelComments, 0, len(d.reviews)+len(d.issueComments))
+	for _, r := range d.reviews {
 		topLevelComments = append(topLevelComments, topLevelComment{
+			id:        getInt(r.ID),
+			kind:      kindReview,
 			body:      getString(r.Body),
 			createdAt: getTime(r.SubmittedAt),
 			author:    getUserLogin(r.User),
-			state:     getString(r.State),
-			commitID:  getString(r.CommitID),
+			bot:       botConfig().isBot(r.User, getString(r.Body)),
+			// Reviews sent from Reviewable are shown split up.
+			editable: getUserLogin(r.User) == currentUser &&
+				!strings.Contains(getString(r.Body), reviewableSent),
+			state:    getString(r.State),
+			commitID: getString(r.CommitID),
 		})
 	}
-	for _, c := range issueComments {
+	for _, c := range d.issueComments {
 		topLevelComments = append(topLevelComments, topLevelComment{
+			id:        getInt(c.ID),
+			kind:      kindIssueComment,
 			body:      getString(c.Body),
 			createdAt: getTime(c.CreatedAt),
 			author:    getUserLogin(c.User),
+			bot:       botConfig().isBot(c.User, getString(c.Body)),
+			editable:  getUserLogin(c.User) == currentUser,
+			reactions: c.Reactions,
 		})
 	}
 	sort.Sort(topLevelComments)
+	return topLevelComments
+}
+
+// makeReviewTemplate writes the review template for PR n to a temporary file,
+// returning its name and the line to open the editor at.
+func makeReviewTemplate(ctx context.Context, n int) (string, int) {
+	d := fetchPR(ctx, n)
+
+	for _, r := range d.reviews {
+		if getString(r.State) == reviewPending && getUserLogin(r.User) == currentUser {
+			log.Printf("You have a pending review on PR %d; GitHub won't accept another "+
+				"until it's submitted or deleted", n)
+		}
+	}
+
+	markSeen(projectOwner, projectRepo, n, d.pr.GetHead().GetSHA())
+
+	template := renderTemplate(ctx, d)
+	var filename string
+	if splitWorkspace() {
+		dir, err := ioutil.TempDir("", "re-edit-")
+		if err != nil {
+			log.Fatal(err)
+		}
+		filename = dir
+		// Keep the workspace as generated, to check the edited one against.
+		for _, dir := range []string{filename, origFilename(filename)} {
+			if err := writeWorkspace(dir, template); err != nil {
+				log.Fatal(err)
+			}
+		}
+		// Jump to lines of the template as it'll be reassembled.
+		if template, _, err = readWorkspace(filename); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		f, err := ioutil.TempFile("", "re-edit-*.re")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f.Name(), template, 0666); err != nil {
+			log.Fatal(err)
+		}
+		filename = f.Name()
+		f.Close()
+		// Keep the template as generated, to check the edited one against.
+		if err := ioutil.WriteFile(origFilename(filename), template, 0666); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return filename, jumpLine(d, template, jumpTarget())
+}
+
+// renderTemplate lays out a fetched PR as a review template: a header with
+// the PR's description and conversation, followed by the diff of each commit
+// with existing inline comments interleaved.
+func renderTemplate(ctx context.Context, d *prData) []byte {
+	reviewComments := make(commitComments)
+	// Threads with a comment from a person are kept even when bots are
+	// hidden, so they can be replied to.
+	humanThreads := make(map[int]bool)
+	for _, comment := range d.reviewComments {
+		reviewComments.put(comment)
+		if !botConfig().isBot(comment.User, comment.GetBody()) {
+			humanThreads[threadRoot(comment)] = true
+		}
+	}
+
+	diff := d.shownDiff()
+	if expanding() {
+		diff = expandDiff(ctx, diff)
+	}
+	comments, reviewable := placeReviewableComments(diff, d.topLevelComments())
 
 	buf := bytes.NewBuffer(make([]byte, 0, 1024))
-	printPR(ctx, buf, pr, diffStat.String(), topLevelComments)
+	checks := ""
+	if d.checks != nil {
+		checks = d.checks.format()
+	}
+	annotations := d.checks.placeAnnotations(diff)
+	printPR(ctx, buf, d.pr, d.reactions, d.diffStat(), checks, comments)
 
 	commit := ""
 	file := ""
 	num := 0
 	foundFirstHunk := false
+	marked := make(map[string]bool)
 	// Parse the `git diff` output, output line-by-line to the review template,
 	// and insert inline comments where they're supposed to go.
-	for _, line := range strings.SplitAfter(diffBuf.String(), "\n") {
+	for _, line := range strings.SplitAfter(diff, "\n") {
 		if line == "" {
 			break
 		}
@@ -268,6 +514,17 @@ Date:	%s
 		fileMatches := fileStart.FindStringSubmatch(line)
 		if len(fileMatches) > 1 {
 			file = fileMatches[1]
+			if d.owners != nil {
+				owners := strings.Join(d.owners.ownersOf(file), " ")
+				if owners == "" {
+					owners = "none"
+				}
+				fmt.Fprintln(buf, ownersAnnotation+owners)
+			}
+			if d.viewed != nil && !marked[file] {
+				fmt.Fprintln(buf, formatViewedMarker(d.viewed[file]))
+				marked[file] = true
+			}
 			continue
 		}
 		// Process first hunk header.
@@ -278,32 +535,84 @@ Date:	%s
 			}
 			continue
 		}
+		if strings.HasPrefix(line, "=") {
+			// Expanded context isn't part of the diff.
+			continue
+		}
 		num++
-		if comments := reviewComments.get(commit, file, num); comments != nil {
+		var comments []*inlineComment
+		for _, comment := range reviewComments.get(commit, file, num) {
+			if botConfig().mode != botsHide || humanThreads[threadRoot(comment)] ||
+				!botConfig().isBot(comment.User, comment.GetBody()) {
+				comments = append(comments, comment)
+			}
+		}
+		if comments != nil {
 			fmt.Fprintf(buf, "%s\n", inlineStartMarker)
 			for _, comment := range comments {
-				fmt.Fprintf(buf, "* Comment by @%s (%s)", getUserLogin(comment.User), getTime(comment.CreatedAt).Format(timeFormat))
+				fmt.Fprintf(buf, "* Comment by %s (%s)", displayLogin(getUserLogin(comment.User), "@"), getTime(comment.CreatedAt).Format(timeFormat))
 				if comment.InReplyTo == nil {
 					fmt.Fprintf(buf, " thread %d", *comment.ID)
+				} else {
+					fmt.Fprintf(buf, " id %d", *comment.ID)
 				}
 				buf.WriteString("\n")
-				fmt.Fprintf(buf, "*\t%s\n", wrap(*comment.Body, "*\t"))
+				body := *comment.Body
+				if getUserLogin(comment.User) == currentUser {
+					writeEditable(buf, *comment.ID, body)
+				} else {
+					if botConfig().mode != botsShow && botConfig().isBot(comment.User, body) {
+						body = botSummary(body)
+					}
+					fmt.Fprintf(buf, "*\t%s\n", renderMarkdown(body, "*\t"))
+				}
+				if reactions := formatReactions(comment.Reactions); reactions != "" {
+					fmt.Fprintf(buf, "*\t%s\n", reactions)
+				}
 			}
 			fmt.Fprintf(buf, "%s\n", inlineEndMarker)
 		}
+		if discussions := reviewable[diffPosition{commit, file, num}]; discussions != nil {
+			writeReviewable(buf, discussions)
+		}
+		if a := annotations[diffPosition{commit, file, num}]; a != nil {
+			writeAnnotations(buf, a)
+		}
 	}
+	fmt.Fprintf(buf, "\n%s\n", templateModeline)
+	return buf.Bytes()
+}
 
-	f, err := ioutil.TempFile("", "re-edit-")
-	if err != nil {
-		log.Fatal(err)
-	}
-	if err := ioutil.WriteFile(f.Name(), buf.Bytes(), 0666); err != nil {
-		log.Fatal(err)
+func listFiles(ctx context.Context, owner, repo string, n int) ([]*github.CommitFile, error) {
+	var all []*github.CommitFile
+	opt := &github.ListOptions{PerPage: 200}
+	for {
+		files, resp, err := client.PullRequests.ListFiles(ctx, owner, repo, n, opt)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, files...)
+
+		opt.Page = resp.NextPage
+		if opt.Page == 0 {
+			break
+		}
 	}
-	filename := f.Name()
-	f.Close()
+	return all, nil
+}
 
-	return filename
+// formatDiffStat lays out the files changed by a PR as a table of names and
+// line counts.
+func formatDiffStat(files []*github.CommitFile) string {
+	var diffStat strings.Builder
+	writer := tabwriter.NewWriter(&diffStat, 10, 4, 4, ' ', 0)
+	for _, file := range files {
+		fmt.Fprintf(writer, "%s\t\t+%d\t-%d\n", file.GetFilename(), file.GetAdditions(), file.GetDeletions())
+	}
+	if err := writer.Flush(); err != nil {
+		panic(err)
+	}
+	return diffStat.String()
 }
 
 const timeFormat = "2006-01-02 15:04:05"
@@ -313,10 +622,17 @@ var (
 	topLevelEndMarker   = "# ------ END OF TOP-LEVEL REVIEW COMMENTS ----- #"
 	inlineStartMarker   = strings.Repeat("*", 79) + "v"
 	inlineEndMarker     = strings.Repeat("*", 79) + "^"
+	// templateModeline gives the template the rereview filetype in vim, and
+	// its highlighting if re editor install has been run. Without it, the
+	// template still looks like git show output to vim.
+	templateModeline = "# vim: set filetype=git.rereview:"
+	// topLevelInstructions starts the instructions, which end the PR's
+	// conversation. Replies can start with #, so no other line does.
+	topLevelInstructions = "# Add top-level review comments by typing between the marker lines below."
 )
 
-func printPR(ctx context.Context, w *bytes.Buffer, pr *github.PullRequest,
-	diffstat string, comments topLevelComments) error {
+func printPR(ctx context.Context, w *bytes.Buffer, pr *pullRequest, prReactions *reactions,
+	diffstat, checks string, comments topLevelComments) error {
 	// Fool tpope/vim-git's filetype detector for Git commit messages
 	fmt.Fprint(w, "commit 0000000000000000000000000000000000000000\n")
 	fmt.Fprintf(w, "Author: %s <>\n", getUserLogin(pr.User))
@@ -329,16 +645,27 @@ func printPR(ctx context.Context, w *bytes.Buffer, pr *github.PullRequest,
 	if pr.ClosedAt != nil {
 		fmt.Fprintf(w, "Closed: %s\n", getTime(pr.ClosedAt).Format(timeFormat))
 	}
-	fmt.Fprintf(w, "URL:    https://github.com/%s/%s/pull/%d\n\n", projectOwner, projectRepo, getInt(pr.Number))
+	fmt.Fprintf(w, "URL:    %s\n", prURL(getInt(pr.Number)))
+	writeMetadata(w, pr)
+	fmt.Fprint(w, "\n")
 
 	fmt.Fprint(w, diffstat)
+	if checks != "" {
+		fmt.Fprintf(w, "\n%s", checks)
+	}
 
-	fmt.Fprintf(w, "\nCreated by %s (%s)\n", getUserLogin(pr.User), getTime(pr.CreatedAt).Format(timeFormat))
+	fmt.Fprintf(w, "\n%s%s (%s)\n", prCreatedBy, displayLogin(getUserLogin(pr.User), ""), getTime(pr.CreatedAt).Format(timeFormat))
 	if pr.Body != nil {
 		text := strings.TrimSpace(*pr.Body)
 		if text != "" {
-			fmt.Fprintf(w, "\n\t%s\n", wrap(text, "\t"))
+			fmt.Fprintf(w, "\n\t%s\n", renderMarkdown(text, "\t"))
+		}
+	}
+	if reactions := formatReactions(prReactions); reactions != "" {
+		if strings.TrimSpace(pr.GetBody()) == "" {
+			fmt.Fprint(w, "\n")
 		}
+		fmt.Fprintf(w, "\t%s\n", reactions)
 	}
 
 	for _, com := range comments {
@@ -350,25 +677,41 @@ func printPR(ctx context.Context, w *bytes.Buffer, pr *github.PullRequest,
 			// Don't print "This change is Reviewable" message
 			continue
 		}
-		if strings.Contains(text, "<!-- Sent from Reviewable.io -->") {
-			// TODO(jordan) parse Reviewable comments into inlie comments.
+		if com.bot {
+			switch botConfig().mode {
+			case botsHide:
+				continue
+			case botsCollapse:
+				text = botSummary(text)
+			}
 		}
 
 		action := "Comment"
 		switch com.state {
-		case reviewApprove:
+		case stateApproved:
 			action = "Approved"
-		case reviewRequestChanges:
+		case stateChangesRequested:
 			action = "Changes requested"
 		case reviewPending:
 			action = "Draft comment"
 		}
-		fmt.Fprintf(w, "\n%s by %s (%s)\n", action, com.author, com.createdAt.Format(timeFormat))
-		fmt.Fprintf(w, "\n\t%s\n", wrap(text, "\t"))
+		fmt.Fprintf(w, "\n%s by %s (%s)", action, displayLogin(com.author, ""), com.createdAt.Format(timeFormat))
+		if com.kind == kindIssueComment {
+			fmt.Fprintf(w, " id %d", com.id)
+		}
+		if com.editable {
+			fmt.Fprint(w, "\n\n")
+			writeEditable(w, com.id, com.body)
+		} else {
+			fmt.Fprintf(w, "\n\n\t%s\n", renderMarkdown(text, "\t"))
+		}
+		if reactions := formatReactions(com.reactions); reactions != "" {
+			fmt.Fprintf(w, "\t%s\n", reactions)
+		}
 	}
 	fmt.Fprint(w, "\n")
 	fmt.Fprintf(w, `
-# Add top-level review comments by typing between the marker lines below.
+%s
 # Don't modify the markers!
 
 %s
@@ -376,14 +719,34 @@ func printPR(ctx context.Context, w *bytes.Buffer, pr *github.PullRequest,
 
 # Add ordinary review comments by typing on a new line below the line of the
 # diff you'd like to comment on. Comments may not begin with the special
-# characters <space>, +, -, @, or *.
+# characters <space>, +, -, =, @, or *.
+#
+# Pre-existing comments are prefixed with *. React to one, or to the PR's
+# description, by typing /react and one of +1, -1, laugh, confused, heart,
+# hooray, rocket or eyes on a line under it, as in /react +1.
+#
+# Your own comments and reviews are between *edit and *end lines, and can be
+# edited there. Replace a comment's text with /delete to delete it.
 #
-# Pre-existing comments are prefixed with *.
+# Reply to the PR's description or a comment at the top by typing under it.
+# Replies are posted as new comments quoting the original.
+#
+# Edit the Labels, Reviewers, Assignees, Milestone and Draft fields in the
+# header to change them. Separate names with commas.
 
-`, topLevelStartMarker, topLevelEndMarker)
+`, topLevelInstructions, topLevelStartMarker, topLevelEndMarker)
 	return nil
 }
 
+// displayLogin returns "you" for the current user's login, and prefix+login
+// for everyone else.
+func displayLogin(login string, prefix string) string {
+	if login == currentUser {
+		return "you"
+	}
+	return prefix + login
+}
+
 var (
 	reviewApprove        = "APPROVE"
 	reviewRequestChanges = "REQUEST_CHANGES"
@@ -391,47 +754,94 @@ var (
 	reviewPending        = "PENDING"
 )
 
-func review(prNum int, filename string) *github.PullRequestReviewRequest {
-	defer os.Remove(filename)
+// review has the user edit the review template in filename and choose what to
+// do with it. A dry run saves the template as a draft instead of removing it,
+// so that what was previewed can be resumed and submitted.
+func review(ctx context.Context, prNum int, filename string, line int) *parsedReview {
+	defer func() {
+		if *dryRun && filepath.Clean(filename) == draftName(prNum) {
+			return
+		}
+		os.RemoveAll(filename)
+		os.RemoveAll(origFilename(filename))
+	}()
 	stdin := bufio.NewReader(os.Stdin)
 	editReview := true
+	var parsed *parsedReview
 	var request *github.PullRequestReviewRequest
 	for {
 		if editReview {
-			request = parseFileUntilSuccess(filename)
+			parsed = parseFileUntilSuccess(ctx, filename, line)
+			line = 0
+			request = parsed.Request
+			for _, e := range parsed.Edits {
+				fmt.Printf("Will %s\n", strings.ToLower(e.describe()))
+			}
+			for _, r := range parsed.Replies {
+				fmt.Printf("Will reply to @%s\n", r.To)
+			}
+			for _, line := range parsed.Metadata.describe() {
+				fmt.Printf("Will %s\n", strings.ToLower(line[:1])+line[1:])
+			}
 		}
 		editReview = true
 
-		fmt.Printf("Submit this review [y,a,r,d,s,p,e,q,?]? ")
+		if *dryRun {
+			fmt.Printf("Preview this review, without submitting it, as [y,a,m,r,d,s,p,x,e,q,?]? ")
+		} else {
+			fmt.Printf("Submit this review [y,a,m,r,d,s,p,x,e,q,?]? ")
+		}
 		text, err := stdin.ReadString('\n')
 		if err != nil && err != io.EOF {
 			log.Fatal(err)
 		} else if err == io.EOF {
 			exitHappy()
 		}
+		finish := func() *parsedReview {
+			if *dryRun {
+				fmt.Println("Saved draft as", saveDraft(prNum, filename))
+			}
+			return parsed
+		}
 		switch text[0] {
 		case 'y':
 			request.Event = &reviewComment
-			return request
+			return finish()
 		case 'a':
 			request.Event = &reviewApprove
-			return request
+			return finish()
+		case 'm':
+			request.Event = &reviewApprove
+			parsed.merge = true
+			return finish()
 		case 'r':
 			request.Event = &reviewRequestChanges
-			return request
+			return finish()
 		case 'd':
 			request.Event = nil
-			return request
+			return finish()
 		case 's':
-			cpCmd := exec.Command("cp", filename, fmt.Sprintf("%d.redraft", prNum))
-			err := cpCmd.Run()
-			if err != nil {
-				log.Fatal(err)
-			}
-			exitHappy("Saved draft as", fmt.Sprintf("%d.redraft", prNum))
+			exitHappy("Saved draft as", saveDraft(prNum, filename))
 		case 'p':
 			editReview = false
-			fmt.Println(request)
+			parsed.preview(os.Stdout)
+			continue
+		case 'x':
+			editReview = false
+			fmt.Printf("Export to file (.json for JSON, otherwise patch-style): ")
+			name, err := stdin.ReadString('\n')
+			if err != nil && err != io.EOF {
+				log.Fatal(err)
+			}
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if err := parsed.exportFile(name); err != nil {
+				fmt.Printf("error exporting review: %v\n", err)
+				continue
+			}
+			fmt.Println("Exported review to", name)
 			continue
 		case 'e':
 			continue
@@ -442,12 +852,22 @@ func review(prNum int, filename string) *github.PullRequestReviewRequest {
 		default:
 			editReview = false
 			color.Set(color.FgRed, color.Bold)
-			fmt.Println("y - submit comments")
-			fmt.Println("a - submit and approve")
-			fmt.Println("r - submit and request changes")
-			fmt.Println("d - publish as draft")
+			if *dryRun {
+				fmt.Println("y - preview as comments and save as a draft")
+				fmt.Println("a - preview as an approval and save as a draft")
+				fmt.Println("m - preview as an approval to merge and save as a draft")
+				fmt.Println("r - preview as a request for changes and save as a draft")
+				fmt.Println("d - preview as a pending review and save as a draft")
+			} else {
+				fmt.Println("y - submit comments")
+				fmt.Println("a - submit and approve")
+				fmt.Println("m - submit, approve and merge")
+				fmt.Println("r - submit and request changes")
+				fmt.Println("d - publish as draft")
+			}
 			fmt.Println("s - save review locally and quit; resume with re <pr> resume")
 			fmt.Println("p - preview review")
+			fmt.Println("x - export review to a file")
 			fmt.Println("e - edit review")
 			fmt.Println("q - quit; abandon review")
 			fmt.Println("? - print help")
@@ -457,17 +877,63 @@ func review(prNum int, filename string) *github.PullRequestReviewRequest {
 	}
 }
 
-func parseFileUntilSuccess(filename string) *github.PullRequestReviewRequest {
+// draftName returns the name of the saved draft of a review of PR prNum.
+func draftName(prNum int) string {
+	return fmt.Sprintf("%d.redraft", prNum)
+}
+
+// saveDraft saves the review template in filename, along with the original
+// it was generated as, as the draft of a review of PR prNum, and returns the
+// draft's name.
+func saveDraft(prNum int, filename string) string {
+	draft := draftName(prNum)
+	if filepath.Clean(filename) == draft {
+		// Resuming a draft edits it in place.
+		return draft
+	}
+	// cp -R would copy a workspace into an old draft's directory, rather
+	// than over it.
+	os.RemoveAll(draft)
+	os.RemoveAll(origFilename(draft))
+	cpCmd := exec.Command("cp", "-R", filename, draft)
+	err := cpCmd.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := os.Stat(origFilename(filename)); err == nil {
+		cpCmd := exec.Command("cp", "-R", origFilename(filename), origFilename(draft))
+		if err := cpCmd.Run(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	return draft
+}
+
+// parseFileUntilSuccess has the user edit filename, starting at line, until
+// it parses and its changes to the header can be made, reopening the editor
+// at the first problem found.
+func parseFileUntilSuccess(ctx context.Context, filename string, line int) *parsedReview {
 	stdin := bufio.NewReader(os.Stdin)
+	orig := readOrig(filename)
 	for {
-		updated, err := editFile(filename)
+		updated, source, err := editFile(filename, line)
 		if err == nil {
-			request, err := parseFile(updated)
+			err = validateTemplate(orig, updated)
+		}
+		if err == nil {
+			var parsed *parsedReview
+			parsed, err = parseEdited(updated, orig)
+			if err == nil {
+				err = parsed.Metadata.resolve(ctx, updated)
+			}
 			if err == nil {
-				return request
+				return parsed
 			}
 		}
-		fmt.Printf("error parsing file: %s\n", err)
+		line = errorLine(err)
+		color.Set(color.FgRed)
+		fmt.Printf("error parsing file:\n%s\n", describeError(err, source))
+		color.Unset()
 		fmt.Printf("edit again? [Y]/q ")
 		text, err := stdin.ReadString('\n')
 		if err != nil && err != io.EOF {
@@ -489,9 +955,142 @@ var commitStart = regexp.MustCompile(`^commit (.*)$`)
 var diffStart = `diff --git `
 var fileStart = regexp.MustCompile(`^\+\+\+ b\/(.*)$`)
 var hunkStart = `@@`
-var threadId = regexp.MustCompile(`^\* Comment by @\w+ \([^\)]+\) thread (\d+)$`)
+var threadId = regexp.MustCompile(`^\* Comment by (?:@\S+|you) \([^\)]+\) thread (\d+)$`)
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+// parsedReview is a review parsed out of an edited template: the request to
+// submit, plus where each of its inline comments was written.
+type parsedReview struct {
+	Request  *github.PullRequestReviewRequest `json:"review"`
+	Comments []*parsedComment                 `json:"comments"`
+	// Viewed holds the files to mark as viewed, or not.
+	Viewed map[string]bool `json:"viewed,omitempty"`
+	// Reactions are the reactions to add to the PR and its comments.
+	Reactions []*parsedReaction `json:"reactions,omitempty"`
+	// Edits are the changes to make to your comments.
+	Edits []*parsedEdit `json:"edits,omitempty"`
+	// Replies are the replies to post to the PR's conversation.
+	Replies []*parsedReply `json:"replies,omitempty"`
+	// Metadata is the changes to make to the PR's labels, reviewers and so
+	// on.
+	Metadata *metadataChange `json:"metadata,omitempty"`
+
+	// header holds the editable fields of the template's header.
+	header map[string]string
+	// merge is whether to merge the PR once the review is submitted.
+	merge bool
+}
+
+// parsedComment locates one of a parsedReview's inline comments in the diff.
+type parsedComment struct {
+	Path string `json:"path"`
+	// Line is the line number in the new version of the file, or in the old
+	// one if Side is LEFT, meaning the comment is on a deleted line.
+	Line int    `json:"line"`
+	Side string `json:"side"`
+	// Context holds the diff lines leading up to the comment.
+	Context []string `json:"context"`
+	Body    string   `json:"body"`
+}
+
+// diffContextLines is how many lines of diff parsedComment.Context keeps.
+const diffContextLines = 4
+
+// hunkLines parses a hunk header, returning the line numbers in the old and
+// new files that precede the hunk.
+func hunkLines(line string) (int, int) {
+	m := hunkHeader.FindStringSubmatch(line)
+	if m == nil {
+		return 0, 0
+	}
+	oldLine, _ := strconv.Atoi(m[1])
+	newLine, _ := strconv.Atoi(m[2])
+	return oldLine - 1, newLine - 1
+}
+
+// diffPosition is a line of a file's diff in a commit, given by its position
+// in the diff.
+type diffPosition struct {
+	commit, file string
+	position     int
+}
+
+// fileLine is a line of a file, as of some commit.
+type fileLine struct {
+	file string
+	line int
+}
 
-func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
+// newLinePositions maps each line of a new file shown in diff, a series of
+// commits with their diffs, to the last place it's shown. Line 0 of a file
+// maps to the first line of its last diff.
+func newLinePositions(diff string) map[fileLine]diffPosition {
+	at := make(map[fileLine]diffPosition)
+	commit := ""
+	file := ""
+	num := 0
+	newLine := 0
+	foundFirstHunk := false
+	for _, line := range strings.Split(diff, "\n") {
+		if m := commitStart.FindStringSubmatch(line); m != nil {
+			foundFirstHunk = false
+			commit = m[1]
+			continue
+		}
+		if strings.HasPrefix(line, diffStart) {
+			foundFirstHunk = false
+			continue
+		}
+		if m := fileStart.FindStringSubmatch(line); m != nil {
+			file = m[1]
+			continue
+		}
+		if !foundFirstHunk {
+			if strings.HasPrefix(line, hunkStart) {
+				foundFirstHunk = true
+				num = 0
+				_, newLine = hunkLines(line)
+				at[fileLine{file, 0}] = diffPosition{commit, file, 1}
+			}
+			continue
+		}
+		if line == "" || line[0] == '=' {
+			continue
+		}
+		num++
+		switch line[0] {
+		case '@':
+			_, newLine = hunkLines(line)
+		case '+', ' ':
+			newLine++
+			at[fileLine{file, newLine}] = diffPosition{commit, file, num}
+		}
+	}
+	return at
+}
+
+// parseEdited parses the edited template, keeping only the changes to viewed
+// markers and your comments made since orig, the template as generated.
+func parseEdited(edited, orig []byte) (*parsedReview, error) {
+	parsed, err := parseFile(edited)
+	if err != nil {
+		return nil, err
+	}
+	o, err := parseFile(orig)
+	if err != nil {
+		o = &parsedReview{}
+	}
+	if o.Viewed != nil {
+		parsed.Viewed = viewedChanges(parsed.Viewed, o.Viewed)
+	}
+	parsed.Edits = commentEdits(parsed.Edits, o.Edits)
+	if parsed.Metadata, err = metadataChanges(parsed.header, o.header); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+func parseFile(b []byte) (*parsedReview, error) {
 	dat := string(b)
 
 	commit := ""
@@ -499,20 +1098,53 @@ func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
 	num := 0
 	foundFirstHunk := false
 
+	oldLine, newLine := 0, 0
+	lastDiffChar := byte(' ')
+	var context []string
+	// expandedContext is set when in expanded context above a file's first
+	// hunk, where comments are also allowed.
+	expandedContext := false
+	bodyPrefix := ""
+
 	commentStart := -1
 	lastCommentStart := -1
 
 	topLevelCommentStart := 0
 
 	lastInlineCommentId := 0
+	// reactTo is what a reaction typed on the current line would go to, if
+	// anything.
+	var reactTo *parsedReaction
+	inConversation := true
+	// editing is the edit of your comment whose text is on the current line,
+	// if any.
+	var editing *parsedEdit
+	var editLines []string
+	editStartLine := 0
+	// editKind is what an edit in the PR's conversation is of: the last
+	// header there tells an issue comment from a review.
+	editKind := targetIssueComment
 
-	reviews := []*github.PullRequestReviewRequest{
-		&github.PullRequestReviewRequest{},
+	review := &github.PullRequestReviewRequest{}
+	parsed := &parsedReview{Request: review, header: make(map[string]string)}
+	// inHeader is whether the current line is in the template's header,
+	// above the PR's description.
+	inHeader := true
+
+	// replying is the comment in the PR's conversation that text on the
+	// current line would be a reply to, if any.
+	var replying *replyTarget
+	finishReply := func() {
+		if replying != nil {
+			if r := replying.reply(); r != nil {
+				parsed.Replies = append(parsed.Replies, r)
+			}
+			replying = nil
+		}
 	}
-	review := reviews[0]
 
 	off := 0
-	for _, line := range strings.SplitAfter(dat, "\n") {
+	for i, line := range strings.SplitAfter(dat, "\n") {
 		lastCommentStart = commentStart
 		commentStart = -1
 		if line == "" {
@@ -524,7 +1156,10 @@ func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
 
 		// Process top level comments.
 		if line == topLevelStartMarker {
+			finishReply()
 			topLevelCommentStart = off
+			inConversation = false
+			reactTo = nil
 			continue
 		} else if line == topLevelEndMarker {
 			topLevelCommentEnd := off - len(line) - 2
@@ -539,10 +1174,82 @@ func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
 			continue
 		}
 
-		if line == inlineStartMarker {
+		if editing != nil {
+			if m := editEnd.FindStringSubmatch(line); m != nil && m[1] == strconv.Itoa(editing.ID) {
+				editing.Body = strings.Join(editLines, "\n")
+				if replying != nil {
+					replying.quote = append(replying.quote, editLines...)
+				}
+				switch body := strings.TrimSpace(editing.Body); {
+				case editing.Kind == targetReview && (body == "" || body == deleteComment):
+					return nil, &parseError{line: editStartLine,
+						msg: fmt.Sprintf("review %d can't be emptied or deleted, only edited", editing.ID)}
+				case body == "":
+					return nil, &parseError{line: editStartLine,
+						msg: fmt.Sprintf("comment %d can't be empty; replace its text with %s to delete it", editing.ID, deleteComment)}
+				}
+				editing = nil
+				continue
+			}
+			editLines = append(editLines, line)
+			continue
+		}
+		if m := editStart.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			editing = &parsedEdit{Kind: targetReviewComment, ID: id}
+			if inConversation {
+				editing.Kind = editKind
+			}
+			parsed.Edits = append(parsed.Edits, editing)
+			editLines = nil
+			editStartLine = i + 1
+			continue
+		}
+		if m := reactionLine.FindStringSubmatch(line); m != nil && reactTo != nil {
+			r := *reactTo
+			r.Content = m[1]
+			if err := checkReaction(r.Content); err != nil {
+				return nil, &parseError{line: i + 1, msg: err.Error()}
+			}
+			parsed.Reactions = append(parsed.Reactions, &r)
+			continue
+		}
+		if inConversation {
+			if strings.HasPrefix(line, prCreatedBy) {
+				reactTo = &parsedReaction{Kind: targetPR}
+			} else if m := issueCommentId.FindStringSubmatch(line); m != nil {
+				id, _ := strconv.Atoi(m[1])
+				reactTo = &parsedReaction{Kind: targetIssueComment, ID: id}
+				editKind = targetIssueComment
+			} else if conversationHeader.MatchString(line) {
+				reactTo = nil
+				editKind = targetReview
+			}
+			if m := metadataField.FindStringSubmatch(line); m != nil && inHeader {
+				parsed.header[m[1]] = strings.TrimSpace(m[2])
+				continue
+			}
+			if t := newReplyTarget(line); t != nil {
+				inHeader = false
+				finishReply()
+				replying = t
+				continue
+			} else if line == topLevelInstructions {
+				// The instructions end the conversation.
+				finishReply()
+				reactTo = nil
+			} else if replying != nil {
+				replying.addLine(line)
+				continue
+			}
+		}
+
+		if line == inlineStartMarker || line == templateModeline {
+			reactTo = nil
 			continue
 		} else if line == inlineEndMarker {
 			lastInlineCommentId = 0
+			reactTo = nil
 			continue
 		}
 		threadIdMatches := threadId.FindStringSubmatch(line)
@@ -550,8 +1257,14 @@ func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
 			var err error
 			lastInlineCommentId, err = strconv.Atoi(threadIdMatches[1])
 			if err != nil {
-				return nil, err
+				return nil, &parseError{line: i + 1, msg: err.Error()}
 			}
+			reactTo = &parsedReaction{Kind: targetReviewComment, ID: lastInlineCommentId}
+			continue
+		}
+		if m := replyId.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			reactTo = &parsedReaction{Kind: targetReviewComment, ID: id}
 			continue
 		}
 
@@ -559,6 +1272,7 @@ func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
 		commitMatches := commitStart.FindStringSubmatch(line)
 		if len(commitMatches) > 1 {
 			foundFirstHunk = false
+			expandedContext = false
 			commit = commitMatches[1]
 			review.CommitID = &commit
 			continue
@@ -568,6 +1282,7 @@ func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
 		// diff or commit marker.
 		if strings.HasPrefix(line, diffStart) {
 			foundFirstHunk = false
+			expandedContext = false
 			continue
 		}
 
@@ -577,13 +1292,30 @@ func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
 			file = fileMatches[1]
 			continue
 		}
+		if m := viewedMarker.FindStringSubmatch(line); m != nil && !foundFirstHunk {
+			if parsed.Viewed == nil {
+				parsed.Viewed = make(map[string]bool)
+			}
+			parsed.Viewed[file] = m[1] != " "
+			continue
+		}
 		// Process first hunk header.
 		if !foundFirstHunk {
 			if strings.HasPrefix(line, hunkStart) {
 				foundFirstHunk = true
 				num = 0
+				oldLine, newLine = hunkLines(line)
+				context = append(context[:0], line)
+				continue
+			}
+			if strings.HasPrefix(line, expandedStart) {
+				expandedContext = true
+				num = 0
+				context = context[:0]
+			}
+			if !expandedContext {
+				continue
 			}
-			continue
 		}
 
 		if len(line) == 0 {
@@ -595,6 +1327,37 @@ func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
 		switch line[0] {
 		case '+', '-', ' ', '@':
 			num++
+			switch line[0] {
+			case '@':
+				oldLine, newLine = hunkLines(line)
+				context = context[:0]
+			case '+':
+				newLine++
+			case '-':
+				oldLine++
+			case ' ':
+				oldLine++
+				newLine++
+			}
+			lastDiffChar = line[0]
+			context = append(context, line)
+			if len(context) > diffContextLines {
+				context = context[1:]
+			}
+			continue
+		case '=':
+			// Expanded context, which takes up no positions.
+			if m := expandedHeader.FindStringSubmatch(line); m != nil {
+				start, _ := strconv.Atoi(m[1])
+				newLine = start - 1
+			} else {
+				newLine++
+			}
+			lastDiffChar = line[0]
+			context = append(context, line)
+			if len(context) > diffContextLines {
+				context = context[1:]
+			}
 			continue
 		case '*', '\t':
 			// Old comment
@@ -605,7 +1368,19 @@ func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
 		commentStart = lastCommentStart
 		if commentStart == -1 {
 			commentStart = off - len(line) - 1
-			comment := makeDraftReviewComment(file, num)
+			bodyPrefix = ""
+			position := num
+			if lastDiffChar == '=' && !expandedHeader.MatchString(context[len(context)-1]) {
+				// GitHub only takes comments on lines of the diff, so a
+				// comment on expanded context goes on the diff line above it,
+				// or the first if there's none, and quotes the line it's on.
+				if position == 0 {
+					position = 1
+				}
+				bodyPrefix = fmt.Sprintf("Line %d:\n```\n%s\n```\n\n",
+					newLine, strings.TrimPrefix(context[len(context)-1], "="))
+			}
+			comment := makeDraftReviewComment(file, position)
 			if lastInlineCommentId != 0 {
 				/* TODO(jordan) figure out how to send raft replies
 				cId := lastInlineCommentId
@@ -615,13 +1390,28 @@ func parseFile(b []byte) (*github.PullRequestReviewRequest, error) {
 				*/
 			}
 			review.Comments = append(review.Comments, comment)
+			pc := &parsedComment{
+				Path:    file,
+				Line:    newLine,
+				Side:    "RIGHT",
+				Context: append([]string(nil), context...),
+			}
+			if lastDiffChar == '-' {
+				pc.Line = oldLine
+				pc.Side = "LEFT"
+			}
+			parsed.Comments = append(parsed.Comments, pc)
 		}
 		c := review.Comments[len(review.Comments)-1]
-		body := dat[commentStart : off-1]
+		body := bodyPrefix + dat[commentStart:off-1]
 		c.Body = &body
+		parsed.Comments[len(parsed.Comments)-1].Body = body
 	}
 
-	return review, nil
+	if editing != nil {
+		return nil, &parseError{line: editStartLine, msg: fmt.Sprintf("*edit %d has no *end %d", editing.ID, editing.ID)}
+	}
+	return parsed, nil
 }
 
 func makeDraftReviewComment(path string, position int) *github.DraftReviewComment {
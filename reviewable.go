@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reviewable (reviewable.io) posts its reviews to GitHub as a single comment,
+// with a section for each of the review's discussions, separated by ---
+// lines. A discussion of a file starts with a header like
+//
+//	*[pkg/foo.go, line 42 at r2](https://reviewable.io/...) ([raw file](...)):*
+//
+// where r2 is the revision, Reviewable's name for a push to the PR. A
+// discussion of a whole file has no line. The header is followed by a quote
+// of the line being discussed, then the comment, which may quote earlier
+// comments in a <details> block.
+
+const reviewableSent = "<!-- Sent from Reviewable.io -->"
+
+var (
+	reviewableHeader = regexp.MustCompile(`^\*\[([^\]]+?)(?:, line (\d+) at r\d+)?\]\([^)]*\)(?: \(\[raw file\]\([^)]*\)\))?:\*$`)
+	reviewableQuoted = regexp.MustCompile(`(?s)<details><summary><i>(.*?)</i></summary><blockquote>\s*(.*?)\s*</blockquote></details>`)
+)
+
+// reviewableDiscussion is a comment on a file from a Reviewable review.
+type reviewableDiscussion struct {
+	path string
+	// line is the line of the new file being discussed, or 0 if it's the
+	// whole file.
+	line      int
+	author    string
+	createdAt time.Time
+	body      string
+	// section is the index of the discussion's section of the Reviewable
+	// comment.
+	section int
+}
+
+// parseReviewable splits the body of a comment sent from Reviewable into its
+// sections, returning them along with the discussions of files among them.
+func parseReviewable(body, author string, createdAt time.Time) ([]*reviewableDiscussion, []string) {
+	var discussions []*reviewableDiscussion
+	sections := strings.Split(strings.Replace(body, "\r\n", "\n", -1), "\n---\n")
+	for i := range sections {
+		sections[i] = strings.TrimSpace(sections[i])
+		lines := strings.SplitN(sections[i], "\n", 2)
+		m := reviewableHeader.FindStringSubmatch(lines[0])
+		if m == nil {
+			continue
+		}
+		d := &reviewableDiscussion{path: m[1], author: author, createdAt: createdAt, section: i}
+		d.line, _ = strconv.Atoi(m[2])
+		if len(lines) > 1 {
+			d.body = cleanReviewableBody(lines[1])
+		}
+		discussions = append(discussions, d)
+	}
+	return discussions, sections
+}
+
+// cleanReviewableBody drops the quote of the line under discussion, which is
+// shown in the template anyway, and turns quotes of earlier comments into
+// plain quotes.
+func cleanReviewableBody(body string) string {
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	body = strings.TrimSpace(strings.Join(lines[i:], "\n"))
+	return reviewableQuoted.ReplaceAllStringFunc(body, func(s string) string {
+		m := reviewableQuoted.FindStringSubmatch(s)
+		quoted := strings.Split(m[2], "\n")
+		for i := range quoted {
+			quoted[i] = strings.TrimRight("> "+quoted[i], " ")
+		}
+		return m[1] + "\n" + strings.Join(quoted, "\n")
+	})
+}
+
+// placeReviewable finds where in diff, a series of commits with their diffs,
+// each Reviewable discussion it can place goes. Since Reviewable's revisions
+// don't map onto commits, a discussion goes on the last line of the diffs of
+// its file that has its line number in the new file, or for a discussion of
+// the whole file, the first line of the file's last diff.
+func placeReviewable(diff string, discussions []*reviewableDiscussion) map[diffPosition][]*reviewableDiscussion {
+	at := newLinePositions(diff)
+	placed := make(map[diffPosition][]*reviewableDiscussion)
+	for _, d := range discussions {
+		if pos, ok := at[fileLine{d.path, d.line}]; ok {
+			placed[pos] = append(placed[pos], d)
+		}
+	}
+	return placed
+}
+
+// placeReviewableComments takes the discussions out of the comments sent from
+// Reviewable that can be shown inline in diff, returning the comments without
+// them and the discussions by where they go.
+func placeReviewableComments(diff string, comments topLevelComments) (topLevelComments, map[diffPosition][]*reviewableDiscussion) {
+	var all []*reviewableDiscussion
+	discussions := make(map[int][]*reviewableDiscussion)
+	sections := make(map[int][]string)
+	for i, c := range comments {
+		if !strings.Contains(c.body, reviewableSent) {
+			continue
+		}
+		discussions[i], sections[i] = parseReviewable(c.body, c.author, c.createdAt)
+		all = append(all, discussions[i]...)
+	}
+	if len(all) == 0 {
+		return comments, nil
+	}
+	placed := placeReviewable(diff, all)
+	shown := make(map[*reviewableDiscussion]bool)
+	for _, ds := range placed {
+		for _, d := range ds {
+			shown[d] = true
+		}
+	}
+
+	// Discussions that can't be placed stay where they were.
+	out := make(topLevelComments, len(comments))
+	copy(out, comments)
+	for i, ds := range discussions {
+		left := sections[i]
+		for _, d := range ds {
+			if shown[d] {
+				left[d.section] = ""
+			}
+		}
+		var kept []string
+		for _, section := range left {
+			if section != "" {
+				kept = append(kept, section)
+			}
+		}
+		out[i].body = strings.Join(kept, "\n\n---\n\n")
+	}
+	return out, placed
+}
+
+// writeReviewable writes discussions from Reviewable as an inline comment
+// block. They can't be replied to, since they aren't GitHub threads.
+func writeReviewable(w io.Writer, discussions []*reviewableDiscussion) {
+	fmt.Fprintf(w, "%s\n", inlineStartMarker)
+	for _, d := range discussions {
+		fmt.Fprintf(w, "* Reviewable comment by %s (%s)\n", displayLogin(d.author, "@"), d.createdAt.Format(timeFormat))
+		fmt.Fprintf(w, "*\t%s\n", renderMarkdown(d.body, "*\t"))
+	}
+	fmt.Fprintf(w, "%s\n", inlineEndMarker)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/google/go-github/github"
+)
+
+// showCmd prints a PR's description, conversation and inline comment
+// threads, as the review template would show them or in -format.
+func showCmd(ctx context.Context, args []string) {
+	if len(args) != 1 {
+		usage()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		usage()
+	}
+	d := fetchPR(ctx, n)
+	if *format == "" {
+		os.Stdout.Write(renderTemplate(ctx, d))
+		return
+	}
+	if err := writeFormatted(os.Stdout, d.threadState(), *format); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseCmd prints the review that re would submit for a review template,
+// such as a saved draft, or split workspace.
+func parseCmd(args []string) {
+	if len(args) != 1 {
+		usage()
+	}
+	data, source, err := readTemplate(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	orig := readOrig(args[0])
+	if err := validateTemplate(orig, data); err != nil {
+		log.Fatal(describeError(err, source))
+	}
+	parsed, err := parseEdited(data, orig)
+	if err != nil {
+		log.Fatal(describeError(err, source))
+	}
+	request := parsed.Request
+	f := *format
+	if f == "" {
+		f = "json"
+	}
+	if err := writeFormatted(os.Stdout, request, f); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// prThreads is the machine-readable form of a PR's conversations.
+type prThreads struct {
+	PullRequest *pullRequest         `json:"pull_request"`
+	Files       []*github.CommitFile `json:"files"`
+	Comments    topLevelComments     `json:"comments"`
+	Threads     []*reviewThread      `json:"threads"`
+}
+
+// reviewThread is an inline comment and its replies.
+type reviewThread struct {
+	ID       int    `json:"id"`
+	Path     string `json:"path"`
+	CommitID string `json:"commit_id"`
+	// Position is nil for outdated threads.
+	Position *int             `json:"position"`
+	Comments []*inlineComment `json:"comments"`
+}
+
+func (d *prData) threadState() *prThreads {
+	return &prThreads{
+		PullRequest: d.pr,
+		Files:       d.files,
+		Comments:    d.topLevelComments(),
+		Threads:     d.threads(),
+	}
+}
+
+// threads groups the PR's inline comments into threads, ordered by when
+// each thread was started.
+func (d *prData) threads() []*reviewThread {
+	byID := make(map[int]*inlineComment)
+	for _, c := range d.reviewComments {
+		byID[getInt(c.ID)] = c
+	}
+	root := func(c *inlineComment) *inlineComment {
+		for c.InReplyTo != nil && byID[*c.InReplyTo] != nil {
+			c = byID[*c.InReplyTo]
+		}
+		return c
+	}
+	threads := make(map[int]*reviewThread)
+	var order []*reviewThread
+	for _, c := range d.reviewComments {
+		r := root(c)
+		t, ok := threads[getInt(r.ID)]
+		if !ok {
+			t = &reviewThread{
+				ID:       getInt(r.ID),
+				Path:     getString(r.Path),
+				CommitID: getString(r.CommitID),
+				Position: r.Position,
+			}
+			threads[t.ID] = t
+			order = append(order, t)
+		}
+		t.Comments = append(t.Comments, c)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return getTime(order[i].Comments[0].CreatedAt).Before(getTime(order[j].Comments[0].CreatedAt))
+	})
+	return order
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A split workspace is a directory holding the review template as several
+// files, which is easier to find your way around for big PRs: an overview
+// with the PR's description, conversation and top-level comments, and one
+// file per changed file, holding each commit's diff of it under the commit's
+// header. An index file records the order of the files and commits, so that
+// they can be put back together into a single template to parse.
+
+const (
+	overviewFile   = "00-overview.re"
+	workspaceIndex = ".index"
+)
+
+var diffFilePath = regexp.MustCompile(`^diff --git a/.* b/(.*)$`)
+
+// splitWorkspace reports whether to review in a split workspace, as asked
+// for with -split or git config re.split.
+func splitWorkspace() bool {
+	return *split || gitConfig("re.split") == "true"
+}
+
+// isWorkspace reports whether filename is a split workspace rather than a
+// single template file.
+func isWorkspace(filename string) bool {
+	fi, err := os.Stat(filename)
+	return err == nil && fi.IsDir()
+}
+
+// writeWorkspace splits template into a workspace in dir.
+func writeWorkspace(dir string, template []byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	lines := templateLines(template)
+	inEdit := editBlockText(lines)
+
+	// The overview is everything up to the first real commit; the template
+	// starts with a fake one.
+	start := len(lines)
+	for i := 1; i < len(lines); i++ {
+		if !inEdit[i] && commitStart.MatchString(lines[i]) {
+			start = i
+			break
+		}
+	}
+	overview := lines[:start]
+
+	var commits, paths []string
+	files := make(map[string][]string)
+	var header []string
+	path := ""
+	for i, line := range lines[start:] {
+		if inEdit[start+i] {
+			if path == "" {
+				header = append(header, line)
+			} else {
+				files[path] = append(files[path], line)
+			}
+			continue
+		}
+		if line == templateModeline {
+			continue
+		}
+		if m := commitStart.FindStringSubmatch(line); m != nil {
+			commits = append(commits, m[1])
+			header = []string{line}
+			path = ""
+			continue
+		}
+		if m := diffFilePath.FindStringSubmatch(line); m != nil {
+			path = m[1]
+			if _, ok := files[path]; !ok {
+				paths = append(paths, path)
+			}
+			files[path] = append(files[path], header...)
+			files[path] = append(files[path], line)
+			continue
+		}
+		if path == "" {
+			header = append(header, line)
+		} else {
+			files[path] = append(files[path], line)
+		}
+	}
+
+	names := []string{overviewFile}
+	write := func(name string, lines []string) error {
+		text := strings.Join(lines, "\n") + "\n"
+		if lines[len(lines)-1] != "" {
+			text += "\n"
+		}
+		text += templateModeline + "\n"
+		return ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0600)
+	}
+	if err := write(overviewFile, overview); err != nil {
+		return err
+	}
+	flatten := strings.NewReplacer("/", "_", string(filepath.Separator), "_")
+	for i, path := range paths {
+		name := fmt.Sprintf("%03d-%s.re", i+1, flatten.Replace(path))
+		names = append(names, name)
+		if err := write(name, files[path]); err != nil {
+			return err
+		}
+	}
+
+	var index strings.Builder
+	for _, c := range commits {
+		fmt.Fprintf(&index, "commit %s\n", c)
+	}
+	for _, name := range names {
+		fmt.Fprintf(&index, "file %s\n", name)
+	}
+	return ioutil.WriteFile(filepath.Join(dir, workspaceIndex), []byte(index.String()), 0600)
+}
+
+// editBlockText returns which of lines are the text of *edit blocks: your own
+// comments as you wrote them, which can look like any part of the template,
+// so mustn't be taken for it.
+func editBlockText(lines []string) []bool {
+	in := make([]bool, len(lines))
+	id := ""
+	for i, line := range lines {
+		if id != "" {
+			if m := editEnd.FindStringSubmatch(line); m != nil && m[1] == id {
+				id = ""
+			} else {
+				in[i] = true
+			}
+		} else if m := editStart.FindStringSubmatch(line); m != nil {
+			id = m[1]
+		}
+	}
+	return in
+}
+
+// readWorkspaceIndex returns the commits and files of the workspace in dir, in
+// order.
+func readWorkspaceIndex(dir string) (commits, files []string, err error) {
+	f, err := os.Open(filepath.Join(dir, workspaceIndex))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "commit":
+			commits = append(commits, fields[1])
+		case "file":
+			files = append(files, fields[1])
+		}
+	}
+	return commits, files, scanner.Err()
+}
+
+// sourceLine is where a line of a reassembled workspace came from.
+type sourceLine struct {
+	file string
+	line int
+}
+
+// readWorkspace puts the workspace in dir back together into a single
+// template, with each commit's diffs in the order they were in originally,
+// and returns it along with where each of its lines came from.
+func readWorkspace(dir string) ([]byte, []sourceLine, error) {
+	commits, files, err := readWorkspaceIndex(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	order := make(map[string]int, len(commits))
+	for i, c := range commits {
+		order[c] = i
+	}
+
+	type chunk struct {
+		commit int
+		lines  []string
+		source []sourceLine
+	}
+	var header chunk
+	var chunks []*chunk
+	for i, name := range files {
+		file := filepath.Join(dir, name)
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if i == 0 {
+			for j, line := range templateLines(data) {
+				header.lines = append(header.lines, line)
+				header.source = append(header.source, sourceLine{file, j + 1})
+			}
+			continue
+		}
+		// Anything above a file's first commit goes along with it. Commits
+		// that aren't in the index, because their header was edited, go
+		// last.
+		c := &chunk{commit: len(commits)}
+		chunks = append(chunks, c)
+		first := true
+		lines := templateLines(data)
+		inEdit := editBlockText(lines)
+		for j, line := range lines {
+			if m := commitStart.FindStringSubmatch(line); m != nil && !inEdit[j] {
+				idx, ok := order[m[1]]
+				if !ok {
+					idx = len(commits)
+				}
+				if first {
+					c.commit = idx
+					first = false
+				} else {
+					c = &chunk{commit: idx}
+					chunks = append(chunks, c)
+				}
+			}
+			c.lines = append(c.lines, line)
+			c.source = append(c.source, sourceLine{file, j + 1})
+		}
+	}
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].commit < chunks[j].commit })
+
+	var buf strings.Builder
+	source := append([]sourceLine(nil), header.source...)
+	for _, line := range header.lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	for _, c := range chunks {
+		for _, line := range c.lines {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+		source = append(source, c.source...)
+	}
+	return []byte(buf.String()), source, nil
+}
+
+// readTemplate reads the review template in filename, which may be a split
+// workspace. For a workspace, it also returns where each line came from.
+func readTemplate(filename string) ([]byte, []sourceLine, error) {
+	if isWorkspace(filename) {
+		return readWorkspace(filename)
+	}
+	data, err := ioutil.ReadFile(filename)
+	return data, nil, err
+}
+
+// templateEditorFiles returns the files to open in the editor to edit the template
+// in filename at line, along with the line in the first of them to open it
+// at. A workspace's files are all opened, starting with the one holding line.
+func templateEditorFiles(filename string, line int) ([]string, int) {
+	if !isWorkspace(filename) {
+		return []string{filename}, line
+	}
+	_, files, err := readWorkspaceIndex(filename)
+	if err != nil {
+		return []string{filename}, 0
+	}
+	for i := range files {
+		files[i] = filepath.Join(filename, files[i])
+	}
+	if line <= 0 {
+		return files, 0
+	}
+	_, source, err := readWorkspace(filename)
+	if err != nil || len(source) == 0 {
+		return files, 0
+	}
+	if line > len(source) {
+		line = len(source)
+	}
+	at := source[line-1]
+	reordered := []string{at.file}
+	for _, f := range files {
+		if f != at.file {
+			reordered = append(reordered, f)
+		}
+	}
+	return reordered, at.line
+}
+
+// describeError describes an error parsing a template, giving the files and
+// lines of the workspace it was reassembled from, if it was, rather than
+// lines of the reassembled template.
+func describeError(err error, source []sourceLine) string {
+	errs, ok := err.(parseErrors)
+	if e, isParseError := err.(*parseError); isParseError {
+		errs, ok = parseErrors{e}, true
+	}
+	if !ok || source == nil {
+		return err.Error()
+	}
+	var msgs []string
+	for _, e := range errs {
+		line := e.line
+		if line > len(source) {
+			line = len(source)
+		}
+		if line < 1 {
+			msgs = append(msgs, e.msg)
+			continue
+		}
+		at := source[line-1]
+		msgs = append(msgs, fmt.Sprintf("%s:%d: %s", filepath.Base(at.file), at.line, e.msg))
+	}
+	return strings.Join(msgs, "\n")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// splitTemplate is a review template with two commits touching two files,
+// commented on throughout, and a comment of yours quoting lines that look
+// like the diff's.
+var splitTemplate = strings.Join([]string{
+	"commit 0000000000000000000000000000000000000000",
+	"Title:  Do the thing",
+	"",
+	"Comment by you (2018-01-02 03:04:05) id 200",
+	"",
+	"*edit 200",
+	"Try this:",
+	"commit bbbb",
+	"diff --git a/foo.go b/foo.go",
+	"*end 200",
+	"",
+	topLevelInstructions,
+	"",
+	topLevelStartMarker,
+	"Looks good overall.",
+	topLevelEndMarker,
+	"",
+	"commit aaaa",
+	"",
+	"    first commit",
+	"",
+	"diff --git a/foo.go b/foo.go",
+	"--- a/foo.go",
+	"+++ b/foo.go",
+	"@@ -1,2 +1,3 @@",
+	" package foo",
+	"+// Foo does things.",
+	"Which things?",
+	" func Foo() {}",
+	"diff --git a/bar.go b/bar.go",
+	"--- a/bar.go",
+	"+++ b/bar.go",
+	"@@ -1,1 +1,2 @@",
+	" package foo",
+	"+func Bar() {}",
+	"Needs a comment.",
+	"",
+	"commit bbbb",
+	"",
+	"    second commit",
+	"",
+	"diff --git a/foo.go b/foo.go",
+	"--- a/foo.go",
+	"+++ b/foo.go",
+	"@@ -1,3 +1,3 @@",
+	" package foo",
+	"-// Foo does things.",
+	"+// Foo does everything.",
+	"Better.",
+	" func Foo() {}",
+	"",
+	templateModeline,
+	"",
+}, "\n")
+
+func TestWorkspaceRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "re-split-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := writeWorkspace(dir, []byte(splitTemplate)); err != nil {
+		t.Fatal(err)
+	}
+	_, files, err := readWorkspaceIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{overviewFile, "001-foo.go.re", "002-bar.go.re"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("workspace files = %q, want %q", files, want)
+	}
+
+	reassembled, source, err := readWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(templateLines(reassembled)); len(source) != n {
+		t.Errorf("got sources for %d lines, want %d", len(source), n)
+	}
+	want, err := parseFile([]byte(splitTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseFile(reassembled)
+	if err != nil {
+		t.Fatalf("parsing reassembled workspace: %v\n%s", err, reassembled)
+	}
+	if len(got.Request.Comments) != 3 {
+		t.Errorf("got %d comments, want 3", len(got.Request.Comments))
+	}
+	if !reflect.DeepEqual(got.Request, want.Request) {
+		t.Errorf("reassembled review = %s, want %s", formatJSON(t, got.Request), formatJSON(t, want.Request))
+	}
+	if !reflect.DeepEqual(got.Edits, want.Edits) {
+		t.Errorf("reassembled edits = %s, want %s", formatJSON(t, got.Edits), formatJSON(t, want.Edits))
+	}
+}
+
+// formatJSON formats v as JSON, for test failures.
+func formatJSON(t *testing.T, v interface{}) string {
+	var b strings.Builder
+	if err := writeFormatted(&b, v, "json"); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
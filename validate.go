@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// parseError is a problem with an edited review template.
+type parseError struct {
+	line int
+	msg  string
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+// parseErrors is every problem found in an edited review template, in order.
+type parseErrors []*parseError
+
+func (e parseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// errorLine returns the line of the template that err is about, or 0 if it
+// isn't about any line in particular.
+func errorLine(err error) int {
+	switch err := err.(type) {
+	case *parseError:
+		return err.line
+	case parseErrors:
+		if len(err) > 0 {
+			return err[0].line
+		}
+	}
+	return 0
+}
+
+// origFilename is where the template in filename, or the split workspace, is
+// kept as it was first generated, so that the edited template can be checked
+// against it.
+func origFilename(filename string) string {
+	return filename + ".orig"
+}
+
+// readOrig returns the originally generated template for filename, or nil if
+// there isn't one, as with drafts saved by older versions of re.
+func readOrig(filename string) []byte {
+	orig, _, err := readTemplate(origFilename(filename))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("can't read original template: %v\n", err)
+	}
+	return orig
+}
+
+// lineOp is one step of a line-by-line diff between the original template and
+// the edited one: a line they have in common ('='), a line added by the
+// editor ('+') or one removed ('-'). a and b index the original and edited
+// lines, respectively; for '-', b is the edited line it was removed before.
+type lineOp struct {
+	kind byte
+	a, b int
+}
+
+// diffLines computes the shortest edit script from a to b with Myers'
+// algorithm. Reviews mostly add a few lines of comments to a long template,
+// so the number of edits, and with it the work done here, stays small.
+func diffLines(a, b []string) []lineOp {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds the furthest x reached on each diagonal k in [-d-1, d+1]
+	// before round d, indexed by k+d+1.
+	var trace [][]int
+	x, y := 0, 0
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[off-d-1:off+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var ops []lineOp
+	for d := len(trace) - 1; d >= 0; d-- {
+		tv := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && tv[k-1+d+1] < tv[k+1+d+1]) {
+			prevK = k + 1
+		}
+		prevX := tv[prevK+d+1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, lineOp{'=', x, y})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				ops = append(ops, lineOp{'+', x, y})
+			} else {
+				x--
+				ops = append(ops, lineOp{'-', x, y})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+func templateLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\n")
+	}
+	return lines
+}
+
+// isDiffLine reports whether line would be read as part of the diff, rather
+// than as a comment, when it's inside a hunk.
+func isDiffLine(line string) bool {
+	return line != "" && strings.IndexByte("+- @=", line[0]) >= 0
+}
+
+// isFileAnnotation reports whether line is one re adds under a file's header,
+// rather than part of the diff.
+func isFileAnnotation(line string) bool {
+	return viewedMarker.MatchString(line) || strings.HasPrefix(line, ownersAnnotation)
+}
+
+// isTemplateLine reports whether line is one of the lines that give the
+// template its structure.
+func isTemplateLine(line string) bool {
+	switch line {
+	case topLevelStartMarker, topLevelEndMarker, inlineStartMarker, inlineEndMarker, templateModeline:
+		return true
+	}
+	return commitStart.MatchString(line) || strings.HasPrefix(line, diffStart) ||
+		fileStart.MatchString(line) || threadId.MatchString(line) || replyId.MatchString(line) ||
+		editStart.MatchString(line) || editEnd.MatchString(line)
+}
+
+// validateTemplate looks for edits to a review template that parseFile would
+// silently misread. If orig, the template as generated, is available, edited
+// is compared against it, to catch changes to the diff and text added where
+// it will be ignored; otherwise only the structure of edited is checked. The
+// returned error is a parseErrors.
+func validateTemplate(orig, edited []byte) error {
+	editedLines := templateLines(edited)
+	var ops []lineOp
+	if orig != nil {
+		ops = diffLines(templateLines(orig), editedLines)
+	} else {
+		for i := range editedLines {
+			ops = append(ops, lineOp{'=', i, i})
+		}
+	}
+	origLines := templateLines(orig)
+
+	var errs parseErrors
+	addError := func(i int, format string, args ...interface{}) {
+		errs = append(errs, &parseError{line: i + 1, msg: fmt.Sprintf(format, args...)})
+	}
+
+	topLevelStart, topLevelEnd := -1, -1
+	topLevel := false
+	inDiff := false
+	inHunk := false
+	// underHunkHeader is whether the current line comes right after a hunk
+	// header, or the header of a run of expanded context, with nothing for a
+	// comment to go on.
+	underHunkHeader := false
+	inThread := false
+	threadID := ""
+	// canReact is whether there's a comment a reaction typed on the current
+	// line would go to.
+	canReact := false
+	// editID is the ID of the comment of yours whose text is on the current
+	// line, if any.
+	editID := ""
+	editLine := 0
+	// canReply is whether text typed on the current line would be a reply to
+	// a comment in the PR's conversation.
+	canReply := false
+	// inHeader is whether the current line is in the template's header,
+	// above the PR's description.
+	inHeader := true
+
+	// checkComment checks a line of text that the reviewer added.
+	checkComment := func(i int, line string) {
+		switch {
+		case editID != "":
+			// Your comments can be edited freely.
+		case topLevel || strings.TrimSpace(line) == "" || isFileAnnotation(line):
+		case reactionLine.MatchString(line):
+			if err := checkReaction(reactionLine.FindStringSubmatch(line)[1]); err != nil {
+				addError(i, "%v", err)
+			} else if !canReact {
+				addError(i, "reaction isn't under a comment that can be reacted to; "+
+					"reactions go under a comment, or the PR's description, and reviews can't be reacted to")
+			}
+		case inHeader && metadataField.MatchString(line):
+			if m := metadataField.FindStringSubmatch(line); m[1] == fieldDraft {
+				if _, err := parseDraft(strings.TrimSpace(m[2])); err != nil {
+					addError(i, "%v", err)
+				}
+			}
+		case canReply && line[0] == '\t':
+			addError(i, "replies may not begin with a tab, which marks the text being replied to")
+		case canReply:
+		case isTemplateLine(line):
+			addError(i, "%q looks like part of the template, which can't be added to", line)
+		case topLevelEnd < 0:
+			addError(i, "text outside the top-level comment markers is ignored; "+
+				"move it between them")
+		case !inHunk:
+			addError(i, "comment outside any diff hunk; "+
+				"comments go on a new line below the diff line they're about")
+		case isDiffLine(line):
+			addError(i, "lines can't be added to the diff; "+
+				"comments may not begin with <space>, +, -, =, or @")
+		case line[0] == '*' || line[0] == '\t':
+			addError(i, "comments may not begin with * or a tab, "+
+				"which mark existing comments")
+		case inThread && threadID == "":
+			addError(i, "reply isn't under a thread; "+
+				"replies go after the * Comment by ... thread N line they're for")
+		case underHunkHeader:
+			addError(i, "comment directly under a hunk header; "+
+				"comments go on a new line below the diff line they're about")
+			// The rest of the comment is part of the same problem.
+			underHunkHeader = false
+		}
+	}
+
+	for i := 0; i < len(ops); i++ {
+		op := ops[i]
+		switch op.kind {
+		case '-':
+			// Changes to the header, other than to the top-level comment
+			// markers, which are checked below, are harmless, as are
+			// removing the modeline and changing the lines re adds under
+			// file headers.
+			if !inDiff || editID != "" || origLines[op.a] == templateModeline || isFileAnnotation(origLines[op.a]) {
+				continue
+			}
+			// Group a run of removed lines with any added lines right after
+			// them, which means the lines were changed rather than removed.
+			j := i
+			for j < len(ops) && ops[j].kind == '-' {
+				j++
+			}
+			removed := origLines[op.a]
+			if j < len(ops) && ops[j].kind == '+' && isDiffLine(editedLines[ops[j].b]) {
+				addError(ops[j].b, "diff line changed from %q to %q; the diff can't be edited",
+					removed, editedLines[ops[j].b])
+				i = j
+			} else if j-i == 1 {
+				addError(op.b, "line %q was deleted; the diff can't be edited", removed)
+				i = j - 1
+			} else {
+				addError(op.b, "%d lines starting with %q were deleted; the diff can't be edited",
+					j-i, removed)
+				i = j - 1
+			}
+			continue
+		case '+':
+			// Restored top-level markers are checked along with the
+			// original ones.
+			if line := editedLines[op.b]; line != topLevelStartMarker && line != topLevelEndMarker {
+				checkComment(op.b, line)
+				continue
+			}
+		}
+
+		line := editedLines[op.b]
+		hunkHeader := editID == "" && inDiff &&
+			(strings.HasPrefix(line, hunkStart) || strings.HasPrefix(line, expandedStart))
+		switch {
+		case editID != "":
+			if m := editEnd.FindStringSubmatch(line); m != nil && m[1] == editID {
+				editID = ""
+			}
+		case editStart.MatchString(line):
+			editID = editStart.FindStringSubmatch(line)[1]
+			editLine = op.b
+		case line == topLevelStartMarker:
+			if topLevelStart >= 0 {
+				addError(op.b, "duplicate top-level comment start marker")
+				continue
+			}
+			topLevelStart = op.b
+			topLevel = true
+			canReact = false
+			canReply = false
+		case line == topLevelEndMarker:
+			if topLevelEnd >= 0 {
+				addError(op.b, "duplicate top-level comment end marker")
+				continue
+			}
+			topLevelEnd = op.b
+			topLevel = false
+		case topLevelStart < 0 && (strings.HasPrefix(line, prCreatedBy) || issueCommentId.MatchString(line)):
+			canReact = true
+			canReply = true
+			inHeader = false
+		case topLevelStart < 0 && conversationHeader.MatchString(line):
+			canReact = false
+			canReply = true
+			inHeader = false
+		case topLevelStart < 0 && line == topLevelInstructions:
+			canReact = false
+			canReply = false
+		case topLevel, line == templateModeline:
+		case commitStart.MatchString(line):
+			inHunk = false
+		case strings.HasPrefix(line, diffStart):
+			inDiff = true
+			inHunk = false
+		case !inHunk:
+			inHunk = strings.HasPrefix(line, hunkStart) || strings.HasPrefix(line, expandedStart)
+		case line == inlineStartMarker:
+			inThread = true
+			threadID = ""
+			canReact = false
+		case line == inlineEndMarker:
+			inThread = false
+			canReact = false
+		case threadId.MatchString(line):
+			threadID = threadId.FindStringSubmatch(line)[1]
+			canReact = true
+		case replyId.MatchString(line):
+			canReact = true
+		case orig == nil && line != "" && !isDiffLine(line) && line[0] != '*' && line[0] != '\t':
+			// Without the original template, only comments that parseFile
+			// would attach to the wrong place can be found.
+			checkComment(op.b, line)
+		}
+		if strings.TrimSpace(line) != "" {
+			underHunkHeader = hunkHeader
+		}
+	}
+
+	if editID != "" {
+		addError(editLine, "*edit %s has no *end %s; restore it to end your comment's text", editID, editID)
+	}
+
+	switch {
+	case topLevelStart < 0 && topLevelEnd < 0:
+		addError(0, "the top-level comment markers are missing; "+
+			"they must be restored for top-level comments to be found")
+	case topLevelStart < 0:
+		addError(topLevelEnd, "the top-level comment start marker is missing or changed")
+	case topLevelEnd < 0:
+		addError(topLevelStart, "the top-level comment end marker is missing or changed")
+	case topLevelEnd < topLevelStart:
+		addError(topLevelEnd, "the top-level comment end marker comes before the start marker")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].line < errs[j].line })
+	return errs
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b []string
+		want []lineOp
+	}{
+		{"empty", nil, nil, nil},
+		{"same", []string{"x", "y"}, []string{"x", "y"},
+			[]lineOp{{'=', 0, 0}, {'=', 1, 1}}},
+		{"insert into empty", nil, []string{"x", "y"},
+			[]lineOp{{'+', 0, 0}, {'+', 0, 1}}},
+		{"insert", []string{"x", "y"}, []string{"x", "n", "y"},
+			[]lineOp{{'=', 0, 0}, {'+', 1, 1}, {'=', 1, 2}}},
+		{"insert at end", []string{"x"}, []string{"x", "n", "m"},
+			[]lineOp{{'=', 0, 0}, {'+', 1, 1}, {'+', 1, 2}}},
+		{"delete all", []string{"x", "y"}, nil,
+			[]lineOp{{'-', 0, 0}, {'-', 1, 0}}},
+		{"delete", []string{"x", "o", "y"}, []string{"x", "y"},
+			[]lineOp{{'=', 0, 0}, {'-', 1, 1}, {'=', 2, 1}}},
+		{"replace", []string{"x", "o", "y"}, []string{"x", "n", "y"},
+			[]lineOp{{'=', 0, 0}, {'-', 1, 1}, {'+', 2, 1}, {'=', 2, 2}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := diffLines(tc.a, tc.b)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("diffLines(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+// validateOrig is a small review template, as re would generate it.
+var validateOrig = strings.Join([]string{
+	"commit 0000000000000000000000000000000000000000",
+	"Title:  Do the thing",
+	"",
+	"Comment by you (2018-01-02 03:04:05) id 200",
+	"",
+	"*edit 200",
+	"I wrote this",
+	"*end 200",
+	"",
+	topLevelInstructions,
+	"",
+	topLevelStartMarker,
+	topLevelEndMarker,
+	"",
+	"commit aaaa",
+	"",
+	"diff --git a/foo.go b/foo.go",
+	"--- a/foo.go",
+	"+++ b/foo.go",
+	"@@ -1,2 +1,3 @@",
+	" package foo",
+	"+// Foo does things.",
+	" func Foo() {}",
+	templateModeline,
+	"",
+}, "\n")
+
+// editOrig returns validateOrig with the line after, or the line old if after is
+// empty, replaced by lines.
+func editOrig(old, after string, lines ...string) string {
+	if after != "" {
+		return strings.Replace(validateOrig, after+"\n", after+"\n"+strings.Join(lines, "\n")+"\n", 1)
+	}
+	return strings.Replace(validateOrig, old+"\n", strings.Join(lines, "\n")+"\n", 1)
+}
+
+func TestValidateTemplate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		noOrig bool
+		edited string
+		// want is the line and part of the message of the error expected,
+		// if any.
+		wantLine int
+		want     string
+	}{
+		{name: "unchanged", edited: validateOrig},
+		{name: "comment", edited: editOrig("", "+// Foo does things.", "Why?")},
+		{name: "top-level comment", edited: editOrig("", topLevelStartMarker, "LGTM")},
+		{name: "edited comment", edited: editOrig("I wrote this", "", "I fixed this")},
+		{name: "changed diff line", edited: editOrig("+// Foo does things.", "", "+// Foo does stuff."),
+			wantLine: 22, want: "diff line changed"},
+		{name: "comment outside hunk", edited: editOrig("", "+++ b/foo.go", "Nice file"),
+			wantLine: 20, want: "outside any diff hunk"},
+		{name: "comment under hunk header", edited: editOrig("", "@@ -1,2 +1,3 @@", "", "Why?", "Really?"),
+			wantLine: 22, want: "directly under a hunk header"},
+		{name: "lost top-level markers", edited: editOrig(topLevelStartMarker+"\n"+topLevelEndMarker, ""),
+			want: "markers are missing"},
+		{name: "unterminated edit", edited: editOrig("*end 200", "", ""),
+			want: "*edit 200 has no *end 200"},
+		{name: "no orig", noOrig: true, edited: editOrig("", "+// Foo does things.", "Why?")},
+		{name: "no orig, comment under hunk header", noOrig: true, edited: editOrig("", "@@ -1,2 +1,3 @@", "Why?"),
+			wantLine: 21, want: "directly under a hunk header"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			orig := []byte(validateOrig)
+			if tc.noOrig {
+				orig = nil
+			}
+			err := validateTemplate(orig, []byte(tc.edited))
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("got no error, want %q", tc.want)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want %q", err, tc.want)
+			}
+			if tc.wantLine != 0 && errorLine(err) != tc.wantLine {
+				t.Errorf("got error at line %d, want %d: %v", errorLine(err), tc.wantLine, err)
+			}
+		})
+	}
+}
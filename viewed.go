@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Files you've marked as viewed on GitHub are marked in the template with a
+// viewedMarker line under the file's header, on its first appearance. The
+// marker can be toggled, and the change is made on GitHub when the review is
+// submitted.
+var viewedMarker = regexp.MustCompile(`^# \[([ xX])\] viewed$`)
+
+func formatViewedMarker(viewed bool) string {
+	if viewed {
+		return "# [x] viewed"
+	}
+	return "# [ ] viewed"
+}
+
+// prViewedState returns the node ID of PR n, which mutations need, and
+// whether you've viewed each of its files since they last changed.
+func prViewedState(ctx context.Context, n int) (string, map[string]bool, error) {
+	const query = `query($owner: String!, $repo: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      id
+      files(first: 100, after: $after) {
+        nodes { path viewerViewedState }
+        pageInfo { hasNextPage endCursor }
+      }
+    }
+  }
+}`
+	viewed := make(map[string]bool)
+	id := ""
+	var after *string
+	for {
+		var data struct {
+			Repository struct {
+				PullRequest struct {
+					ID    string `json:"id"`
+					Files struct {
+						Nodes []struct {
+							Path              string `json:"path"`
+							ViewerViewedState string `json:"viewerViewedState"`
+						} `json:"nodes"`
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+					} `json:"files"`
+				} `json:"pullRequest"`
+			} `json:"repository"`
+		}
+		err := graphQL(ctx, query, map[string]interface{}{
+			"owner": projectOwner, "repo": projectRepo, "number": n, "after": after,
+		}, &data)
+		if err != nil {
+			return "", nil, err
+		}
+		pr := data.Repository.PullRequest
+		id = pr.ID
+		for _, f := range pr.Files.Nodes {
+			viewed[f.Path] = f.ViewerViewedState == "VIEWED"
+		}
+		if !pr.Files.PageInfo.HasNextPage {
+			break
+		}
+		cursor := pr.Files.PageInfo.EndCursor
+		after = &cursor
+	}
+	return id, viewed, nil
+}
+
+// applyViewed marks files of PR n as viewed or not, as in marks, skipping
+// those already in that state.
+func applyViewed(ctx context.Context, n int, marks map[string]bool) error {
+	id, current, err := prViewedState(ctx, n)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(marks))
+	for path := range marks {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		viewed := marks[path]
+		if current[path] == viewed {
+			continue
+		}
+		mutation := "unmarkFileAsViewed"
+		if viewed {
+			mutation = "markFileAsViewed"
+		}
+		query := fmt.Sprintf(`mutation($id: ID!, $path: String!) {
+  %s(input: {pullRequestId: $id, path: $path}) { clientMutationId }
+}`, mutation)
+		if err := graphQL(ctx, query, map[string]interface{}{"id": id, "path": path}, nil); err != nil {
+			return fmt.Errorf("%s %s: %v", mutation, path, err)
+		}
+		if viewed {
+			fmt.Printf("Marked %s as viewed\n", path)
+		} else {
+			fmt.Printf("Marked %s as not viewed\n", path)
+		}
+	}
+	return nil
+}
+
+// hideViewed reports whether files you've viewed should be left out of the
+// template, as asked for with -hide-viewed or git config re.hideViewed.
+func hideViewed() bool {
+	return *hideViewedFiles || gitConfig("re.hideViewed") == "true"
+}
+
+// viewedChanges returns the viewed markers in marks that differ from those
+// in orig, the markers as the template was generated.
+func viewedChanges(marks, orig map[string]bool) map[string]bool {
+	changes := make(map[string]bool)
+	for path, viewed := range marks {
+		if was, ok := orig[path]; !ok || was != viewed {
+			changes[path] = viewed
+		}
+	}
+	return changes
+}